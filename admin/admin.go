@@ -0,0 +1,188 @@
+// Package admin 提供可挂载到业务服务中的 gpipe 管理接口, 用于查询拓扑、统计以及控制节点
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/goccy/go-graphviz"
+	"github.com/nosuchperson/gpipe"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Handler 路由均为相对路径, 挂载到子路径时请配合 http.StripPrefix 使用
+//
+//	GET  /                              内嵌的 web 页面, 展示拓扑与实时 QPS
+//	GET  /events?interval=1s            以 server-sent events 推送统计信息
+//	GET  /topology?format=json|dot|svg|mermaid|plantuml 当前拓扑, 默认为 json
+//	GET  /stats                         所有节点的统计信息
+//	GET  /modules                       已注册的模块列表
+//	POST /nodes/{name}/pause            暂停节点
+//	POST /nodes/{name}/resume           恢复节点
+//	POST /nodes/{name}/stop             停止节点的所有 parallel
+//	POST /nodes/{name}/restart          以相同的 parallels 重启节点
+//	POST /nodes/{name}/scale?parallels=N 调整节点的 parallels
+//	POST /nodes/{name}/log?level=warn&sampleRate=10&burst=5 调整节点的日志级别与采样
+type Handler struct {
+	engine *gpipe.Engine
+	mux    *http.ServeMux
+}
+
+func NewHandler(engine *gpipe.Engine) *Handler {
+	h := &Handler{engine: engine, mux: http.NewServeMux()}
+	h.mux.HandleFunc("/", h.handleDashboard)
+	h.mux.HandleFunc("/events", h.handleEvents)
+	h.mux.HandleFunc("/topology", h.handleTopology)
+	h.mux.HandleFunc("/stats", h.handleStats)
+	h.mux.HandleFunc("/modules", h.handleModules)
+	h.mux.HandleFunc("/nodes/", h.handleNodeControl)
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) handleTopology(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "json":
+		writeJSON(w, http.StatusOK, h.engine.Topology())
+	case "mermaid":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte(h.engine.Topology().Mermaid()))
+	case "plantuml":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte(h.engine.Topology().PlantUML()))
+	case "dot", "svg":
+		graphFormat, contentType := graphviz.XDOT, "text/vnd.graphviz; charset=utf-8"
+		if format == "svg" {
+			graphFormat, contentType = graphviz.SVG, "image/svg+xml"
+		}
+		if out, err := h.engine.GraphState(graphFormat); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+		} else {
+			w.Header().Set("Content-Type", contentType)
+			_, _ = w.Write([]byte(out))
+		}
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Errorf("unknown format %s", format))
+	}
+}
+
+func (h *Handler) handleStats(w http.ResponseWriter, r *http.Request) {
+	if allowMethod(w, r, http.MethodGet) {
+		writeJSON(w, http.StatusOK, h.engine.Stats())
+	}
+}
+
+func (h *Handler) handleModules(w http.ResponseWriter, r *http.Request) {
+	if allowMethod(w, r, http.MethodGet) {
+		writeJSON(w, http.StatusOK, h.engine.Registry().List())
+	}
+}
+
+// handleNodeControl 处理 /nodes/{name}/{action}
+func (h *Handler) handleNodeControl(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/nodes/"), "/")
+	if len(parts) != 2 || parts[0] == "" {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown path %s", r.URL.Path))
+		return
+	}
+	name, action := parts[0], parts[1]
+	if !h.nodeExists(name) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("node %s not exists", name))
+		return
+	}
+
+	var err error
+	switch action {
+	case "pause":
+		err = h.engine.PauseNode(name)
+	case "resume":
+		err = h.engine.ResumeNode(name)
+	case "stop":
+		err = h.engine.StopNode(name)
+	case "restart":
+		err = h.engine.RestartNode(r.Context(), name)
+	case "log":
+		err = h.setNodeLogConfig(name, r)
+	case "scale":
+		var parallels int
+		if parallels, err = strconv.Atoi(r.URL.Query().Get("parallels")); err == nil {
+			err = h.engine.ScaleNode(name, parallels)
+		}
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown action %s", action))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	for _, node := range h.engine.Stats() {
+		if node.Node == name {
+			writeJSON(w, http.StatusOK, node)
+			return
+		}
+	}
+}
+
+// setNodeLogConfig 根据 level / sampleRate / burst 参数调整节点日志配置, 未提供的参数保持不变
+func (h *Handler) setNodeLogConfig(name string, r *http.Request) error {
+	cfg, err := h.engine.NodeLogConfig(name)
+	if err != nil {
+		return err
+	}
+	query := r.URL.Query()
+	if v := query.Get("level"); v != "" {
+		if cfg.Level, err = gpipe.ParseLogLevel(v); err != nil {
+			return err
+		}
+	}
+	if v := query.Get("sampleRate"); v != "" {
+		if cfg.SampleRate, err = strconv.ParseFloat(v, 64); err != nil {
+			return err
+		}
+	}
+	if v := query.Get("burst"); v != "" {
+		if cfg.Burst, err = strconv.Atoi(v); err != nil {
+			return err
+		}
+	}
+	return h.engine.SetNodeLogConfig(name, cfg)
+}
+
+func (h *Handler) nodeExists(name string) bool {
+	for _, node := range h.engine.Stats() {
+		if node.Node == name {
+			return true
+		}
+	}
+	return false
+}
+
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,133 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/nosuchperson/gpipe"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestEngine(t *testing.T) *gpipe.Engine {
+	genName, sinkName := uuid.NewString(), uuid.NewString()
+	assert.NoError(t, gpipe.RegisterModule(gpipe.NewSimpleModule(genName, func(name string, config interface{}) (gpipe.ModuleInstance, error) {
+		return gpipe.NewSimpleModuleInstance(genName, name, func(ctx context.Context, modCtx gpipe.ModuleContext) error {
+			for i := 0; ; i++ {
+				select {
+				case _ = <-ctx.Done():
+					return nil
+				case _ = <-time.After(time.Millisecond):
+					modCtx.Collect(i)
+				}
+			}
+		}), nil
+	})))
+	assert.NoError(t, gpipe.RegisterModule(gpipe.NewSimpleModule(sinkName, func(name string, config interface{}) (gpipe.ModuleInstance, error) {
+		return gpipe.NewSimpleModuleInstance(sinkName, name, func(ctx context.Context, modCtx gpipe.ModuleContext) error {
+			for {
+				select {
+				case _ = <-ctx.Done():
+					return nil
+				case _ = <-modCtx.MessageQueue():
+				}
+			}
+		}), nil
+	})))
+	eng := gpipe.NewEngine()
+	assert.NoError(t, eng.Run(context.Background(), strings.NewReader(fmt.Sprintf(`
+engine:
+  Gen:
+    module: %s
+    parent: [ ]
+    queueSize: 1
+    parallels: 1
+  Sink:
+    module: %s
+    parent: [ Gen ]
+    queueSize: 8
+    parallels: 1
+`, genName, sinkName))))
+	return eng
+}
+
+func doRequest(t *testing.T, h http.Handler, method, path string, out interface{}) int {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+	if out != nil {
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), out))
+	}
+	return rec.Code
+}
+
+func TestHandler_Query(t *testing.T) {
+	eng := newTestEngine(t)
+	defer eng.Stop()
+	h := NewHandler(eng)
+
+	topo := gpipe.Topology{}
+	assert.Equal(t, http.StatusOK, doRequest(t, h, http.MethodGet, "/topology", &topo))
+	assert.Equal(t, 2, len(topo.Nodes))
+	assert.Equal(t, "Gen", topo.Edges[0].From)
+	assert.Equal(t, "Sink", topo.Edges[0].To)
+	assert.NotNil(t, topo.Nodes[0].Stats)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/topology?format=dot", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "digraph")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/topology?format=mermaid", nil))
+	assert.Contains(t, rec.Body.String(), "flowchart TB")
+	assert.Equal(t, http.StatusBadRequest, doRequest(t, h, http.MethodGet, "/topology?format=gif", nil))
+
+	stats := []gpipe.NodeStats{}
+	assert.Equal(t, http.StatusOK, doRequest(t, h, http.MethodGet, "/stats", &stats))
+	assert.Equal(t, "Sink", stats[1].Node)
+
+	modules := []string{}
+	assert.Equal(t, http.StatusOK, doRequest(t, h, http.MethodGet, "/modules", &modules))
+	assert.Contains(t, modules, stats[0].Module)
+}
+
+func TestHandler_NodeControl(t *testing.T) {
+	eng := newTestEngine(t)
+	defer eng.Stop()
+	h := NewHandler(eng)
+
+	stats := gpipe.NodeStats{}
+	assert.Equal(t, http.StatusOK, doRequest(t, h, http.MethodPost, "/nodes/Sink/scale?parallels=3", &stats))
+	assert.Equal(t, 3, stats.Parallels)
+
+	assert.Equal(t, http.StatusOK, doRequest(t, h, http.MethodPost, "/nodes/Sink/pause", &stats))
+	assert.True(t, stats.Paused)
+	time.Sleep(time.Millisecond * 100)
+	received := eng.Stats()[1].Receive
+	// 暂停后队列被写满, 上游阻塞
+	time.Sleep(time.Millisecond * 100)
+	assert.Equal(t, received, eng.Stats()[1].Receive)
+
+	assert.Equal(t, http.StatusOK, doRequest(t, h, http.MethodPost, "/nodes/Sink/resume", &stats))
+	assert.False(t, stats.Paused)
+	time.Sleep(time.Millisecond * 100)
+	assert.Greater(t, eng.Stats()[1].Receive, received)
+
+	assert.Equal(t, http.StatusOK, doRequest(t, h, http.MethodPost, "/nodes/Sink/log?level=error&sampleRate=5", &stats))
+	logCfg, err := eng.NodeLogConfig("Sink")
+	assert.NoError(t, err)
+	assert.Equal(t, gpipe.NodeLogConfig{Level: gpipe.LogLevelError, SampleRate: 5, Burst: 1}, logCfg)
+	assert.Equal(t, http.StatusBadRequest, doRequest(t, h, http.MethodPost, "/nodes/Sink/log?level=loud", nil))
+
+	assert.Equal(t, http.StatusOK, doRequest(t, h, http.MethodPost, "/nodes/Sink/stop", &stats))
+	assert.Equal(t, 0, stats.Parallels)
+
+	assert.Equal(t, http.StatusNotFound, doRequest(t, h, http.MethodPost, "/nodes/Unknown/pause", nil))
+	assert.Equal(t, http.StatusNotFound, doRequest(t, h, http.MethodPost, "/nodes/Sink/explode", nil))
+	assert.Equal(t, http.StatusBadRequest, doRequest(t, h, http.MethodPost, "/nodes/Sink/scale?parallels=-1", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, doRequest(t, h, http.MethodGet, "/nodes/Sink/pause", nil))
+}
@@ -0,0 +1,68 @@
+package admin
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const defaultEventsInterval = time.Second
+
+//go:embed web/index.html
+var dashboardPage []byte
+
+// handleDashboard 在根路径提供内嵌的 web 页面, 页面通过 /events 获取实时数据
+func (h *Handler) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown path %s", r.URL.Path))
+		return
+	}
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write(dashboardPage)
+}
+
+// handleEvents 以 server-sent events 的形式定时推送所有节点的统计信息, 可通过 interval 参数调整推送间隔
+func (h *Handler) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	interval := defaultEventsInterval
+	if v := r.URL.Query().Get("interval"); v != "" {
+		var err error
+		if interval, err = time.ParseDuration(v); err != nil || interval <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid interval %s", v))
+			return
+		}
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming unsupported"))
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		data, err := json.Marshal(h.engine.Stats())
+		if err != nil {
+			return
+		}
+		if _, err := fmt.Fprintf(w, "event: stats\ndata: %s\n\n", data); err != nil {
+			return
+		}
+		flusher.Flush()
+		select {
+		case _ = <-r.Context().Done():
+			return
+		case _ = <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package admin
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/nosuchperson/gpipe"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler_Dashboard(t *testing.T) {
+	eng := newTestEngine(t)
+	defer eng.Stop()
+	h := NewHandler(eng)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `new EventSource("events")`)
+	assert.Equal(t, http.StatusNotFound, doRequest(t, h, http.MethodGet, "/unknown", nil))
+}
+
+func TestHandler_Events(t *testing.T) {
+	eng := newTestEngine(t)
+	defer eng.Stop()
+	server := httptest.NewServer(NewHandler(eng))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/events?interval=10ms")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	reader := bufio.NewReader(resp.Body)
+	for i := 0; i < 2; i++ {
+		event, err := reader.ReadString('\n')
+		assert.NoError(t, err)
+		assert.Equal(t, "event: stats\n", event)
+		data, err := reader.ReadString('\n')
+		assert.NoError(t, err)
+		stats := []gpipe.NodeStats{}
+		assert.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(data, "data: ")), &stats))
+		assert.Equal(t, 2, len(stats))
+		_, _ = reader.ReadString('\n')
+	}
+
+	assert.Equal(t, http.StatusBadRequest, doRequest(t, NewHandler(eng), http.MethodGet, "/events?interval=abc", nil))
+}
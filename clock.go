@@ -0,0 +1,44 @@
+package gpipe
+
+import "time"
+
+// Clock 引擎及定时类模块使用的时钟, 通过 EngineWithClock 替换, 模块通过 ModuleContext.Clock 获取
+// 测试中可以使用 gpipetest.FakeClock 手动推进时间, 无需真实等待
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker Clock 创建的 ticker, 与 time.Ticker 相同, 处理不及时的 tick 会被丢弃
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// SystemClock 返回使用系统时间的 Clock, 为 Engine 的默认值
+func SystemClock() Clock {
+	return systemClock{}
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+type systemTicker struct {
+	*time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
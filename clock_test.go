@@ -0,0 +1,48 @@
+package gpipe
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingClock 记录创建的 ticker 数量, 其余行为与系统时钟相同
+type countingClock struct {
+	Clock
+	tickers atomic.Int32
+}
+
+func (c *countingClock) NewTicker(d time.Duration) Ticker {
+	c.tickers.Add(1)
+	return c.Clock.NewTicker(d)
+}
+
+func TestEngineWithClock(t *testing.T) {
+	clock := &countingClock{Clock: SystemClock()}
+	modName := uuid.NewString()
+	got := make(chan Clock, 1)
+	assert.NoError(t, RegisterModule(NewSimpleModule(modName, func(name string, config interface{}) (ModuleInstance, error) {
+		return NewSimpleModuleInstance(modName, name, func(ctx context.Context, modCtx ModuleContext) error {
+			got <- modCtx.Clock()
+			<-ctx.Done()
+			return nil
+		}), nil
+	})))
+	eng := NewEngine(EngineWithClock(clock))
+	assert.NoError(t, eng.Run(context.Background(), strings.NewReader(`
+engine:
+  Node:
+    module: `+modName+`
+    parent: [ ]
+`)))
+	defer eng.Stop()
+	assert.Same(t, clock, <-got)
+	// QPS 统计使用引擎的时钟
+	assert.Eventually(t, func() bool { return clock.tickers.Load() == 1 }, time.Second, time.Millisecond)
+
+	assert.Equal(t, SystemClock(), NewEngine().clock)
+}
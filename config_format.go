@@ -0,0 +1,79 @@
+package gpipe
+
+import (
+	"bufio"
+	"bytes"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+type ConfigFormat string
+
+const (
+	ConfigFormatAuto ConfigFormat = ""
+	ConfigFormatYAML ConfigFormat = "yaml"
+	ConfigFormatJSON ConfigFormat = "json"
+	ConfigFormatTOML ConfigFormat = "toml"
+)
+
+var tomlLinePattern = regexp.MustCompile(`^(\[\[?[\w."' -]+\]\]?|[\w."'-]+\s*=)`)
+
+// configFormatOf 根据文件扩展名判断格式, 无法判断时返回 ConfigFormatAuto
+func configFormatOf(name string) ConfigFormat {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yml", ".yaml":
+		return ConfigFormatYAML
+	case ".json":
+		return ConfigFormatJSON
+	case ".toml":
+		return ConfigFormatTOML
+	}
+	return ConfigFormatAuto
+}
+
+// detectConfigFormat 根据内容判断格式: 首个有效行形如 `[table]` 或 `key = value` 时为 TOML, 以 `{` 开头为 JSON, 否则为 YAML
+func detectConfigFormat(data []byte) ConfigFormat {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		} else if strings.HasPrefix(line, "{") {
+			return ConfigFormatJSON
+		} else if tomlLinePattern.MatchString(line) {
+			return ConfigFormatTOML
+		}
+		break
+	}
+	return ConfigFormatYAML
+}
+
+// parseConfigNode 将配置解析为 yaml.Node, JSON 作为 YAML 的子集直接解析以保留行号, TOML 转换后不包含行号
+func parseConfigNode(data []byte, format ConfigFormat) (*yaml.Node, error) {
+	if format == ConfigFormatAuto {
+		format = detectConfigFormat(data)
+	}
+	root := &yaml.Node{}
+	switch format {
+	case ConfigFormatYAML, ConfigFormatJSON:
+		if err := yaml.Unmarshal(data, root); err != nil {
+			return nil, err
+		}
+	case ConfigFormatTOML:
+		m := map[string]interface{}{}
+		if err := toml.Unmarshal(data, &m); err != nil {
+			return nil, err
+		}
+		doc := &yaml.Node{}
+		if err := doc.Encode(m); err != nil {
+			return nil, err
+		}
+		root = &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{doc}}
+	default:
+		return nil, newGPWError("unknown config format %s", format)
+	}
+	return root, nil
+}
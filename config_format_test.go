@@ -0,0 +1,104 @@
+package gpipe
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEngine_LoadConfigFormats(t *testing.T) {
+	expect := func(cfg *Config) {
+		source := cfg.Engine["Source"]
+		assert.Equal(t, "interval", source.Module)
+		assert.Equal(t, []string{}, source.Parent)
+		assert.Equal(t, 2, source.Parallels)
+		assert.Equal(t, map[string]interface{}{"interval": 10}, source.Config)
+		assert.Equal(t, []string{"Source"}, cfg.Engine["Sink"].Parent)
+	}
+	jsonCfg := `{
+  "engine": {
+    "Source": { "module": "interval", "parent": [], "parallels": 2, "config": { "interval": 10 } },
+    "Sink": { "module": "blackhole", "parent": [ "Source" ] }
+  }
+}`
+	tomlCfg := `
+# comment
+[engine.Source]
+module = "interval"
+parent = []
+parallels = 2
+config = { interval = 10 }
+
+[engine.Sink]
+module = "blackhole"
+parent = [ "Source" ]
+`
+	for format, data := range map[ConfigFormat]string{ConfigFormatJSON: jsonCfg, ConfigFormatTOML: tomlCfg} {
+		// 根据内容判断
+		cfg, err := NewEngine().LoadConfig(strings.NewReader(data))
+		if assert.NoError(t, err, format) {
+			expect(cfg)
+		}
+		// 显式指定
+		cfg, err = NewEngine(EngineWithConfigFormat(format)).LoadConfig(strings.NewReader(data))
+		if assert.NoError(t, err, format) {
+			expect(cfg)
+		}
+		// 根据扩展名判断, include 的文件同样按扩展名解析
+		dir := t.TempDir()
+		file := filepath.Join(dir, "pipeline."+string(format))
+		assert.NoError(t, os.WriteFile(file, []byte(data), 0644))
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "main.yml"), []byte("include: [ pipeline."+string(format)+" ]\n"), 0644))
+		for _, name := range []string{file, filepath.Join(dir, "main.yml")} {
+			fd, err := os.Open(name)
+			assert.NoError(t, err)
+			cfg, err = NewEngine().LoadConfig(fd)
+			fd.Close()
+			if assert.NoError(t, err, name) {
+				expect(cfg)
+			}
+		}
+	}
+
+	_, err := NewEngine(EngineWithConfigFormat(ConfigFormatTOML)).LoadConfig(strings.NewReader("[engine.Source]\nmodul = 1\n"))
+	if assert.Error(t, err) {
+		assert.Equal(t, "config: unknown field modul", err.Error())
+	}
+}
+
+func TestEngine_RunConfig(t *testing.T) {
+	genName, sinkName := uuid.NewString(), uuid.NewString()
+	recv := make(chan interface{}, 1)
+	assert.NoError(t, RegisterModule(NewSimpleModule(genName, func(name string, config interface{}) (ModuleInstance, error) {
+		return NewSimpleModuleInstance(genName, name, func(ctx context.Context, modCtx ModuleContext) error {
+			modCtx.Collect(config)
+			return nil
+		}), nil
+	})))
+	assert.NoError(t, RegisterModule(NewSimpleModule(sinkName, func(name string, config interface{}) (ModuleInstance, error) {
+		return NewSimpleModuleInstance(sinkName, name, func(ctx context.Context, modCtx ModuleContext) error {
+			recv <- <-modCtx.MessageQueue()
+			return nil
+		}), nil
+	})))
+	cfg := &Config{Engine: map[string]*WorkNodeConfig{
+		"Gen":  {Module: genName, Config: "hello"},
+		"Sink": {Module: sinkName, Parent: []string{"Gen"}, QueueSize: 1},
+	}}
+
+	assert.Error(t, NewEngine().RunConfig(context.Background(), &Config{Engine: map[string]*WorkNodeConfig{
+		"Gen": {Module: genName, Parent: []string{"Missing"}},
+	}}))
+
+	eng := NewEngine()
+	assert.NoError(t, eng.RunConfig(context.Background(), cfg))
+	defer eng.Stop()
+	assert.Equal(t, "hello", <-recv)
+	// 默认值只作用于引擎内部的副本
+	assert.Equal(t, 0, cfg.Engine["Gen"].Parallels)
+	assert.Equal(t, ErrEngineIsRunning, eng.RunConfig(context.Background(), cfg))
+}
@@ -0,0 +1,435 @@
+package gpipe
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+)
+
+// configLoader 在 yaml.Node 层面处理 include / templates / ${...} 引用, 最后解码为 Config
+type configLoader struct {
+	engine  *Engine
+	in      *interpolator
+	baseDir string
+	format  ConfigFormat
+	sources map[*yaml.Node]string // 通过 include 引入的节点所在的文件, 用于错误定位
+	loading map[string]bool       // 正在加载的文件, 用于检测循环 include
+}
+
+func (e *Engine) newConfigLoader(r io.Reader) *configLoader {
+	baseDir, format := e.configDir, e.configFormat
+	if f, ok := r.(interface{ Name() string }); ok {
+		if baseDir == "" {
+			baseDir = filepath.Dir(f.Name())
+		}
+		if format == ConfigFormatAuto {
+			format = configFormatOf(f.Name())
+		}
+	}
+	return &configLoader{
+		engine:  e,
+		in:      &interpolator{resolvers: e.secretResolvers},
+		baseDir: baseDir,
+		format:  format,
+		sources: map[*yaml.Node]string{},
+		loading: map[string]bool{},
+	}
+}
+
+func (l *configLoader) load(r io.Reader) (*Config, error) {
+	configMap, err := l.decode(r)
+	if err != nil {
+		return nil, err
+	}
+	return configMap, configMap.RedactError(configMap.Valid())
+}
+
+// decode 解析配置并展开子图、填充默认值, 但不做 Valid 校验
+func (l *configLoader) decode(r io.Reader) (*Config, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	root, err := parseConfigNode(data, l.format)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.resolveIncludes(root, l.baseDir); err != nil {
+		return nil, err
+	}
+	if err := l.resolveTemplates(root); err != nil {
+		return nil, err
+	}
+	if doc := documentMapping(root); doc != nil {
+		if err := l.checkKnownFields(doc, reflect.TypeOf(Config{})); err != nil {
+			return nil, err
+		}
+	}
+	if err := l.in.interpolateNode(root); err != nil {
+		return nil, redactError(err, l.in.secrets)
+	}
+	configMap := &Config{secrets: l.in.secrets, registry: l.engine.registry}
+	if err := root.Decode(configMap); err != nil {
+		return nil, configMap.RedactError(err)
+	}
+	l.annotate(root, configMap)
+	if err := l.checkSubgraphs(root, configMap); err != nil {
+		return nil, configMap.RedactError(err)
+	}
+	if err := configMap.expandSubgraphs(); err != nil {
+		return nil, configMap.RedactError(err)
+	}
+	configMap.applyDefaults(l.engine.nodeDefaults)
+	return configMap, nil
+}
+
+// checkKnownFields 检查 mapping 中的 key 均为 t 中声明过的字段, 相当于带位置信息的 KnownFields
+func (l *configLoader) checkKnownFields(node *yaml.Node, t reflect.Type) error {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t.Kind() == reflect.Struct && node.Kind == yaml.MappingNode:
+		fields, rest := yamlFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			fieldType, ok := fields[key.Value]
+			if !ok && rest != nil {
+				fieldType, ok = rest, true
+			}
+			if !ok {
+				return newGPWError("%s: unknown field %s", l.position(key), key.Value)
+			} else if err := l.checkKnownFields(node.Content[i+1], fieldType); err != nil {
+				return err
+			}
+		}
+	case t.Kind() == reflect.Map && node.Kind == yaml.MappingNode:
+		for i := 1; i < len(node.Content); i += 2 {
+			if err := l.checkKnownFields(node.Content[i], t.Elem()); err != nil {
+				return err
+			}
+		}
+	case t.Kind() == reflect.Slice && node.Kind == yaml.SequenceNode:
+		for _, item := range node.Content {
+			if err := l.checkKnownFields(item, t.Elem()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// annotate 记录各节点在配置文件中的位置, 以及 queueSize / parallels 是否显式配置
+func (l *configLoader) annotate(root *yaml.Node, configMap *Config) {
+	doc := documentMapping(root)
+	if doc == nil {
+		return
+	}
+	annotateEngine := func(engineNode *yaml.Node, nodes map[string]*WorkNodeConfig) {
+		if engineNode == nil {
+			return
+		}
+		for i := 0; i+1 < len(engineNode.Content); i += 2 {
+			key, value := engineNode.Content[i], engineNode.Content[i+1]
+			if nodeCfg, ok := nodes[key.Value]; ok && nodeCfg != nil {
+				nodeCfg.pos = l.position(key)
+				nodeCfg.queueSizeSet = mappingKey(value, "queueSize") != nil
+				nodeCfg.parallelsSet = mappingKey(value, "parallels") != nil
+			}
+		}
+	}
+	annotateEngine(mappingValue(doc, "engine"), configMap.Engine)
+	if subgraphsNode := mappingValue(doc, "subgraphs"); subgraphsNode != nil {
+		for i := 0; i+1 < len(subgraphsNode.Content); i += 2 {
+			if sub, ok := configMap.Subgraphs[subgraphsNode.Content[i].Value]; ok && sub != nil {
+				annotateEngine(mappingValue(subgraphsNode.Content[i+1], "engine"), sub.Engine)
+			}
+		}
+	}
+}
+
+// checkSubgraphs 子图的定义以及其中的节点不能为空, 例如 `subgraphs: {x: }`
+func (l *configLoader) checkSubgraphs(root *yaml.Node, configMap *Config) error {
+	doc := documentMapping(root)
+	if doc == nil {
+		return nil
+	}
+	subgraphsNode := mappingValue(doc, "subgraphs")
+	if subgraphsNode == nil {
+		return nil
+	}
+	for i := 0; i+1 < len(subgraphsNode.Content); i += 2 {
+		key := subgraphsNode.Content[i]
+		sub := configMap.Subgraphs[key.Value]
+		if sub == nil {
+			return newGPWError("%s: subgraph %s is empty", l.position(key), key.Value)
+		}
+		engineNode := mappingValue(subgraphsNode.Content[i+1], "engine")
+		if engineNode == nil {
+			continue
+		}
+		for j := 0; j+1 < len(engineNode.Content); j += 2 {
+			if childKey := engineNode.Content[j]; sub.Engine[childKey.Value] == nil {
+				return newGPWError("%s: subgraph %s worker %s is empty", l.position(childKey), key.Value, childKey.Value)
+			}
+		}
+	}
+	return nil
+}
+
+// position 返回节点在配置文件中的位置
+func (l *configLoader) position(node *yaml.Node) string {
+	file, hasFile := l.sources[node]
+	switch {
+	case node.Line == 0 && hasFile:
+		// 由 TOML 转换而来的节点没有行号
+		return file
+	case node.Line == 0:
+		return "config"
+	case hasFile:
+		return fmt.Sprintf("%s:%d", file, node.Line)
+	}
+	return fmt.Sprintf("line %d", node.Line)
+}
+
+// resolveIncludes 将 include 中列出的文件 (相对于当前文件所在目录, 支持通配符) 的 engine 与 templates 合并进来
+func (l *configLoader) resolveIncludes(root *yaml.Node, baseDir string) error {
+	doc := documentMapping(root)
+	if doc == nil {
+		return nil
+	}
+	includeNode := removeMappingKey(doc, "include")
+	if includeNode == nil {
+		return nil
+	}
+	patterns := []string{}
+	if err := includeNode.Decode(&patterns); err != nil {
+		return newGPWError("%s: invalid include: %s", l.position(includeNode), err)
+	}
+	for _, pattern := range patterns {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(baseDir, pattern)
+		}
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			return newGPWError("%s: invalid include %s: %s", l.position(includeNode), pattern, err)
+		} else if len(files) == 0 {
+			return newGPWError("%s: include %s matches no file", l.position(includeNode), pattern)
+		}
+		sort.Strings(files)
+		for _, file := range files {
+			if err := l.includeFile(doc, file); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (l *configLoader) includeFile(doc *yaml.Node, file string) error {
+	absPath, err := filepath.Abs(file)
+	if err != nil {
+		return err
+	}
+	if l.loading[absPath] {
+		return newGPWError("include cycle detected at %s", file)
+	}
+	l.loading[absPath] = true
+	defer delete(l.loading, absPath)
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	root, err := parseConfigNode(data, configFormatOf(file))
+	if err != nil {
+		return newGPWError("%s: %s", file, err)
+	}
+	l.markSource(root, file)
+	if err := l.resolveIncludes(root, filepath.Dir(file)); err != nil {
+		return err
+	}
+	included := documentMapping(root)
+	if included == nil {
+		return nil
+	}
+	for _, section := range []string{"engine", "templates", "subgraphs"} {
+		if err := l.mergeSection(doc, included, section); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeSection 将 from 中 section 下的条目合并到 to 中, 条目重名时报错
+func (l *configLoader) mergeSection(to, from *yaml.Node, section string) error {
+	fromSection := mappingValue(from, section)
+	if fromSection == nil {
+		return nil
+	}
+	toSection := mappingValue(to, section)
+	if toSection == nil {
+		toSection = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		to.Content = append(to.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: section}, toSection)
+	}
+	for i := 0; i+1 < len(fromSection.Content); i += 2 {
+		key := fromSection.Content[i]
+		if exists := mappingKey(toSection, key.Value); exists != nil {
+			return newGPWError("%s: duplicate %s name %s, already defined at %s", l.position(key), section, key.Value, l.position(exists))
+		}
+		toSection.Content = append(toSection.Content, key, fromSection.Content[i+1])
+	}
+	return nil
+}
+
+func (l *configLoader) markSource(node *yaml.Node, file string) {
+	l.sources[node] = file
+	for _, child := range node.Content {
+		l.markSource(child, file)
+	}
+}
+
+// resolveTemplates 将 engine 中带有 extends 的节点与对应模板深度合并, 节点自身的配置优先
+func (l *configLoader) resolveTemplates(root *yaml.Node) error {
+	doc := documentMapping(root)
+	if doc == nil {
+		return nil
+	}
+	templatesNode := removeMappingKey(doc, "templates")
+	templates := map[string]*yaml.Node{}
+	if templatesNode != nil {
+		if templatesNode.Kind != yaml.MappingNode {
+			return newGPWError("%s: templates must be a mapping", l.position(templatesNode))
+		}
+		for i := 0; i+1 < len(templatesNode.Content); i += 2 {
+			templates[templatesNode.Content[i].Value] = templatesNode.Content[i+1]
+		}
+	}
+	engineNodes := []*yaml.Node{mappingValue(doc, "engine")}
+	if subgraphsNode := mappingValue(doc, "subgraphs"); subgraphsNode != nil && subgraphsNode.Kind == yaml.MappingNode {
+		for i := 1; i < len(subgraphsNode.Content); i += 2 {
+			if subgraphsNode.Content[i].Kind == yaml.MappingNode {
+				engineNodes = append(engineNodes, mappingValue(subgraphsNode.Content[i], "engine"))
+			}
+		}
+	}
+	for _, engineNode := range engineNodes {
+		if engineNode == nil || engineNode.Kind != yaml.MappingNode {
+			continue
+		}
+		for i := 0; i+1 < len(engineNode.Content); i += 2 {
+			resolved, err := l.extend(engineNode.Content[i+1], templates, map[string]bool{})
+			if err != nil {
+				return newGPWError("worker %s: %s", engineNode.Content[i].Value, err)
+			}
+			engineNode.Content[i+1] = resolved
+		}
+	}
+	return nil
+}
+
+// extend 递归展开 node 的 extends, visiting 用于检测模板之间的循环继承
+func (l *configLoader) extend(node *yaml.Node, templates map[string]*yaml.Node, visiting map[string]bool) (*yaml.Node, error) {
+	if node.Kind != yaml.MappingNode {
+		return node, nil
+	}
+	extendsNode := mappingValue(node, "extends")
+	if extendsNode == nil {
+		return node, nil
+	}
+	name := extendsNode.Value
+	template, ok := templates[name]
+	if !ok {
+		return nil, newGPWError("%s: unknown template %s", l.position(extendsNode), name)
+	} else if visiting[name] {
+		return nil, newGPWError("%s: template %s extends itself", l.position(extendsNode), name)
+	}
+	visiting[name] = true
+	base, err := l.extend(template, templates, visiting)
+	if err != nil {
+		return nil, err
+	}
+	override := copyNode(node)
+	removeMappingKey(override, "extends")
+	// 每个继承的节点持有模板的独立副本, 插值会原地修改 scalar, 共享时会被重复处理
+	return mergeNode(deepCopyNode(base), override), nil
+}
+
+// mergeNode 深度合并两个节点: 均为 mapping 时逐 key 合并, 否则 override 覆盖 base
+func mergeNode(base, override *yaml.Node) *yaml.Node {
+	if base.Kind != yaml.MappingNode || override.Kind != yaml.MappingNode {
+		return override
+	}
+	merged := copyNode(base)
+	for i := 0; i+1 < len(override.Content); i += 2 {
+		key, value := override.Content[i], override.Content[i+1]
+		if idx := mappingIndex(merged, key.Value); idx >= 0 {
+			merged.Content[idx+1] = mergeNode(merged.Content[idx+1], value)
+		} else {
+			merged.Content = append(merged.Content, key, value)
+		}
+	}
+	return merged
+}
+
+func copyNode(node *yaml.Node) *yaml.Node {
+	cp := *node
+	cp.Content = append([]*yaml.Node{}, node.Content...)
+	return &cp
+}
+
+func deepCopyNode(node *yaml.Node) *yaml.Node {
+	cp := *node
+	cp.Content = make([]*yaml.Node, len(node.Content))
+	for i, child := range node.Content {
+		cp.Content[i] = deepCopyNode(child)
+	}
+	return &cp
+}
+
+func documentMapping(root *yaml.Node) *yaml.Node {
+	if root.Kind == yaml.DocumentNode && len(root.Content) == 1 && root.Content[0].Kind == yaml.MappingNode {
+		return root.Content[0]
+	}
+	return nil
+}
+
+func mappingIndex(node *yaml.Node, key string) int {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func mappingKey(node *yaml.Node, key string) *yaml.Node {
+	if idx := mappingIndex(node, key); idx >= 0 {
+		return node.Content[idx]
+	}
+	return nil
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if idx := mappingIndex(node, key); idx >= 0 {
+		return node.Content[idx+1]
+	}
+	return nil
+}
+
+func removeMappingKey(node *yaml.Node, key string) *yaml.Node {
+	idx := mappingIndex(node, key)
+	if idx < 0 {
+		return nil
+	}
+	value := node.Content[idx+1]
+	node.Content = append(node.Content[:idx], node.Content[idx+2:]...)
+	return value
+}
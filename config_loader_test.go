@@ -0,0 +1,203 @@
+package gpipe
+
+import (
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEngine_LoadConfigIncludeAndTemplates(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "nodes"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "templates.yml"), []byte(`
+templates:
+  kafkaBase:
+    module: kafka/producer
+    queueSize: 16
+    parallels: 2
+    config:
+      brokers: kafka:9092
+      producer:
+        acks: all
+        retries: 3
+`), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "nodes", "sink.yml"), []byte(`
+engine:
+  Sink:
+    extends: kafkaBase
+    parent: [ Source ]
+    config:
+      topic: out
+      producer:
+        retries: 5
+`), 0644))
+	main := filepath.Join(dir, "pipeline.yml")
+	assert.NoError(t, os.WriteFile(main, []byte(`
+include: [ templates.yml, "nodes/*.yml" ]
+engine:
+  Source:
+    module: interval
+    parent: [ ]
+    queueSize: 0
+    parallels: 1
+    config:
+      interval: 10
+`), 0644))
+
+	fd, err := os.Open(main)
+	assert.NoError(t, err)
+	defer fd.Close()
+	cfg, err := NewEngine().LoadConfig(fd)
+	assert.NoError(t, err)
+	assert.Len(t, cfg.Engine, 2)
+	sink := cfg.Engine["Sink"]
+	assert.Equal(t, "kafka/producer", sink.Module)
+	assert.Equal(t, []string{"Source"}, sink.Parent)
+	assert.Equal(t, 16, sink.QueueSize)
+	assert.Equal(t, 2, sink.Parallels)
+	assert.Equal(t, map[string]interface{}{
+		"brokers": "kafka:9092",
+		"topic":   "out",
+		"producer": map[string]interface{}{
+			"acks":    "all",
+			"retries": 5,
+		},
+	}, sink.Config)
+}
+
+func TestEngine_LoadConfigIncludeError(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "a.yml"), []byte("include: [ b.yml ]\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "b.yml"), []byte("include: [ a.yml ]\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "dup.yml"), []byte(`
+engine:
+  Source:
+    module: interval
+    parent: [ ]
+`), 0644))
+	eng := NewEngine(EngineWithConfigDir(dir))
+
+	for cfg, msg := range map[string]string{
+		"include: [ a.yml ]":       "include cycle",
+		"include: [ missing.yml ]": "matches no file",
+		`include: [ dup.yml ]
+engine:
+  Source:
+    module: interval
+    parent: [ ]`: "duplicate engine name Source",
+		`engine:
+  Source:
+    extends: nope
+    parent: [ ]`: "unknown template nope",
+		`templates:
+  a: { extends: b }
+  b: { extends: a }
+engine:
+  Source:
+    extends: a
+    parent: [ ]`: "extends itself",
+	} {
+		_, err := eng.LoadConfig(strings.NewReader(cfg))
+		if assert.Error(t, err, cfg) {
+			assert.Contains(t, err.Error(), msg)
+		}
+	}
+}
+
+func TestEngine_LoadConfigDefaults(t *testing.T) {
+	modName := uuid.NewString()
+	assert.NoError(t, RegisterModule(NewSimpleModule(modName, func(name string, config interface{}) (ModuleInstance, error) {
+		return nil, nil
+	}, SimpleModuleWithDefaults(NodeDefaults{QueueSize: 64, Parallels: 4}))))
+
+	cfg, err := NewEngine(EngineWithNodeDefaults(NodeDefaults{QueueSize: 8, Parallels: 2})).LoadConfig(strings.NewReader(`
+engine:
+  Engine:
+    module: interval
+    parent: [ ]
+  Module:
+    module: ` + modName + `
+    parent: [ Engine ]
+  Explicit:
+    module: ` + modName + `
+    parent: [ Engine ]
+    queueSize: 0
+    parallels: 1
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, 8, cfg.Engine["Engine"].QueueSize)
+	assert.Equal(t, 2, cfg.Engine["Engine"].Parallels)
+	assert.Equal(t, 64, cfg.Engine["Module"].QueueSize)
+	assert.Equal(t, 4, cfg.Engine["Module"].Parallels)
+	assert.Equal(t, 0, cfg.Engine["Explicit"].QueueSize)
+	assert.Equal(t, 1, cfg.Engine["Explicit"].Parallels)
+
+	cfg, err = NewEngine().LoadConfig(strings.NewReader(`
+engine:
+  Source:
+    module: interval
+    parent: [ ]
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, cfg.Engine["Source"].QueueSize)
+	assert.Equal(t, 1, cfg.Engine["Source"].Parallels)
+}
+
+func TestEngine_LoadConfigValidation(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "nodes.yml"), []byte(`
+engine:
+  Included:
+    module: interval
+    parent: [ Missing ]
+`), 0644))
+	eng := NewEngine(EngineWithConfigDir(dir))
+	for cfg, msg := range map[string]string{
+		`
+engine:
+  Source:
+    module: interval
+    parent: [ ]
+    parallels: 0`: "line 3: worker Source has invalid parallels 0",
+		`
+engine:
+  Source:
+    module: interval
+    parent: [ ]
+    queueSize: -1`: "line 3: worker Source has invalid queueSize -1",
+		`
+engine:
+  Source:
+    module: interval
+    parent: [ ]
+    paralels: 2`: "line 6: unknown field paralels",
+		`
+engine:
+  Source:
+    module: interval
+    parent: [ ]
+    log:
+      levle: info`: "line 7: unknown field levle",
+		`
+engines:
+  Source:
+    module: interval`: "line 2: unknown field engines",
+		`include: [ nodes.yml ]`: "nodes.yml:3: worker Included has invalid parent Missing",
+		`
+engine:
+  A:
+    module: interval
+    parent: [ B ]
+  B:
+    module: interval
+    parent: [ A ]`: "has cycle among A, B",
+	} {
+		_, err := eng.LoadConfig(strings.NewReader(cfg))
+		if assert.Error(t, err, cfg) {
+			assert.Contains(t, err.Error(), msg)
+		}
+	}
+}
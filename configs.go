@@ -1,25 +1,117 @@
 package gpipe
 
-import "fmt"
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
 
 type WorkNodeConfig struct {
-	Module    string      `yaml:"module"`
-	Parent    []string    `yaml:"parent"`
-	QueueSize int         `yaml:"queueSize"`
-	Parallels int         `yaml:"parallels"`
-	Config    interface{} `yaml:"config"`
+	Module    string         `yaml:"module"`
+	Parent    []string       `yaml:"parent"`
+	QueueSize int            `yaml:"queueSize"`
+	Parallels int            `yaml:"parallels"`
+	Config    interface{}    `yaml:"config"`
+	Log       *NodeLogConfig `yaml:"log,omitempty"`
+
+	subgraph     string        // 由子图展开时所属的子图实例名, 例如 a.b
+	subgraphs    []string      // 展开路径上的子图名, 用于检测子图的循环引用
+	pos          string        // 在配置文件中的位置, 用于错误提示
+	queueSizeSet bool          // 配置中显式设置了 queueSize
+	parallelsSet bool          // 配置中显式设置了 parallels
+	factory      ModuleFactory // 由 Pipeline 直接传入的模块, 优先于按 Module 查找
+}
+
+// NodeDefaults 节点未配置 queueSize / parallels 时使用的默认值
+type NodeDefaults struct {
+	QueueSize int
+	Parallels int
 }
+
+// ModuleDefaults ModuleFactory 可选实现的接口, 提供该模块节点的默认值, 优先于引擎级别的默认值
+type ModuleDefaults interface {
+	Defaults() *NodeDefaults
+}
+
+var defaultNodeDefaults = NodeDefaults{QueueSize: 0, Parallels: 1}
+
+// moduleFactory 返回节点使用的模块, 由 Pipeline 直接传入的模块优先
+func (cfg *WorkNodeConfig) moduleFactory(registry *Registry) (ModuleFactory, error) {
+	if cfg.factory != nil {
+		return cfg.factory, nil
+	}
+	return registry.Get(cfg.Module)
+}
+
+// getRegistry 返回查找模块使用的注册表, 未指定时使用全局注册表
+func (cfg *Config) getRegistry() *Registry {
+	if cfg.registry != nil {
+		return cfg.registry
+	}
+	return moduleRegister
+}
+
+// errorf 生成带有配置位置的错误
+func (cfg *WorkNodeConfig) errorf(format string, args ...interface{}) error {
+	if cfg.pos != "" {
+		return newGPWError("%s: %s", cfg.pos, fmt.Sprintf(format, args...))
+	}
+	return newGPWError(format, args...)
+}
+
+// applyDefaults 为未显式配置 queueSize / parallels 的节点填充默认值
+// 在代码中构造的配置无法区分是否设置, 值为 0 时视为未设置
+func (cfg *Config) applyDefaults(engineDefaults NodeDefaults) {
+	for _, nodeCfg := range cfg.Engine {
+		defaults := engineDefaults
+		if mod, err := nodeCfg.moduleFactory(cfg.getRegistry()); err == nil {
+			if withDefaults, ok := mod.(ModuleDefaults); ok && withDefaults.Defaults() != nil {
+				defaults = *withDefaults.Defaults()
+			}
+		}
+		if !nodeCfg.queueSizeSet && nodeCfg.QueueSize == 0 {
+			nodeCfg.QueueSize = defaults.QueueSize
+		}
+		if !nodeCfg.parallelsSet && nodeCfg.Parallels == 0 {
+			nodeCfg.Parallels = defaults.Parallels
+		}
+	}
+}
+
 type Config struct {
-	Engine map[string]*WorkNodeConfig `yaml:"engine"`
+	Engine    map[string]*WorkNodeConfig `yaml:"engine"`
+	Subgraphs map[string]*SubgraphConfig `yaml:"subgraphs,omitempty"`
+	secrets   []string                   // 由 SecretResolver 解析出的敏感信息, 用于脱敏
+	registry  *Registry                  // 查找模块使用的注册表, 为 nil 时使用全局注册表
+}
+
+// clone 复制节点配置, 避免展开子图、填充默认值时修改调用方的 Config
+func (cfg *Config) clone() *Config {
+	ret := &Config{
+		Engine:    make(map[string]*WorkNodeConfig, len(cfg.Engine)),
+		Subgraphs: cfg.Subgraphs,
+		secrets:   cfg.secrets,
+		registry:  cfg.registry,
+	}
+	for name, nodeCfg := range cfg.Engine {
+		cp := *nodeCfg
+		cp.Parent = append([]string{}, nodeCfg.Parent...)
+		ret.Engine[name] = &cp
+	}
+	return ret
 }
 
 func (cfg *Config) Valid() error {
 	if err := cfg.workerNameIsValid(); err != nil {
 		return err
+	} else if err := cfg.hasInvalidSize(); err != nil {
+		return err
 	} else if err := cfg.hasInvalidParent(); err != nil {
 		return err
 	} else if err := cfg.hasCycle(); err != nil {
 		return err
+	} else if err := cfg.hasInvalidModuleConfig(); err != nil {
+		return err
 	}
 	return nil
 }
@@ -36,18 +128,55 @@ func (cfg *Config) workerNameIsValid() error {
 	return nil
 }
 
+// hasInvalidSize 检查 queueSize 与 parallels 的取值, parallels 为 0 的节点永远不会运行
+func (cfg *Config) hasInvalidSize() error {
+	for _, name := range cfg.sortedNames() {
+		if msg := cfg.Engine[name].sizeError(); msg != "" {
+			return cfg.Engine[name].errorf("worker %s has %s", name, msg)
+		}
+	}
+	return nil
+}
+
+// sizeError 返回 queueSize / parallels 取值的错误, 没有错误时返回空串
+func (cfg *WorkNodeConfig) sizeError() string {
+	if cfg.Parallels <= 0 {
+		return fmt.Sprintf("invalid parallels %d, must be greater than 0", cfg.Parallels)
+	} else if cfg.QueueSize < 0 {
+		return fmt.Sprintf("invalid queueSize %d", cfg.QueueSize)
+	}
+	return ""
+}
+
 // hasInvalidParent 检查是否有不存在的父节点
 func (cfg *Config) hasInvalidParent() error {
-	for name, nodeCfg := range cfg.Engine {
-		for _, parent := range nodeCfg.Parent {
-			if _, exists := cfg.Engine[parent]; !exists {
-				return newGPWError(fmt.Sprintf("worker %s has invalid parent %s", name, parent))
-			}
+	for _, name := range cfg.sortedNames() {
+		for _, parent := range cfg.invalidParents(name) {
+			return cfg.Engine[name].errorf("worker %s has invalid parent %s", name, parent)
 		}
 	}
 	return nil
 }
 
+func (cfg *Config) invalidParents(name string) []string {
+	ret := []string{}
+	for _, parent := range cfg.Engine[name].Parent {
+		if _, exists := cfg.Engine[parent]; !exists {
+			ret = append(ret, parent)
+		}
+	}
+	return ret
+}
+
+func (cfg *Config) sortedNames() []string {
+	names := make([]string, 0, len(cfg.Engine))
+	for name := range cfg.Engine {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func (cfg *Config) hasCycle() error {
 	// 注意该检测只能最后最后一项检测
 	// 构造完整图
@@ -103,7 +232,13 @@ func (cfg *Config) hasCycle() error {
 		}
 	}
 	if len(nodes) > 0 {
-		return newGPWError("has cycle")
+		// 剩余的节点均在环上或位于环的下游
+		names := make([]string, 0, len(nodes))
+		for _, node := range nodes {
+			names = append(names, node.name)
+		}
+		sort.Strings(names)
+		return newGPWError("has cycle among %s", strings.Join(names, ", "))
 	}
 	return nil
 }
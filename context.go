@@ -3,6 +3,8 @@ package gpipe
 import (
 	"context"
 	"fmt"
+	"go.opentelemetry.io/otel/trace"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -21,33 +23,64 @@ type ModuleFactory interface {
 // ModuleContext 用于公开暴露 moduleContext 这个私有结构的接口
 type ModuleContext interface {
 	Name() string
+	// NodeName 配置中的节点名
+	NodeName() string
+	// ParallelIndex 当前 parallel 的序号, 节点级别的 context 为 -1
+	ParallelIndex() int
 	Logger() Logger
 	MessageQueue() chan interface{}
 	Collect(v interface{})
+	// CollectWithContext 与 Collect 相同, 但使用 ctx 中的 trace 信息作为下游消息的上级 span
+	CollectWithContext(ctx context.Context, v interface{})
+	// Context 当前正在处理的消息所对应的 ctx, 携带其 trace 信息
+	Context() context.Context
 	GetModuleFactory() ModuleFactory
 	GetModuleInstance() ModuleInstance
+	// Clock 引擎的时钟, 定时类模块应使用它而不是 time 包, 以便在测试中替换
+	Clock() Clock
 }
 
 // moduleContext 用于描述每个 Instance 在运行时的状态, 并可对其进行部分控制
 type moduleContext struct {
-	engine          *Engine
-	name            string               // 名称, module 的实例名称
-	ctx             context.Context      // 该 Node 的主 ctx
-	stop            context.CancelFunc   // 该 Node 的停止信号
-	module          ModuleFactory        // 关联的模块
-	moduleInst      ModuleInstance       // 关联的实例
-	engCfg          *WorkNodeConfig      // 节点的 Engine 配置
-	input           chan interface{}     // 该节点的输入口, 输出口为该 Node 的下游接口, 该节点退出应该就自动释放
-	parallelsCancel []context.CancelFunc // ctrl -> 控制每个 goroutine 是否退出, 主要是 parallels 的控制, 每个 parallels 可以独立控制是否退出，便于动态扩容起停
-	downstream      []*moduleContext     // 下游节点
+	engine        *Engine
+	name          string             // 名称, module 的实例名称
+	nodeName      string             // 配置中的节点名
+	ctx           context.Context    // 该 Node 的主 ctx
+	stop          context.CancelFunc // 该 Node 的停止信号
+	module        ModuleFactory      // 关联的模块
+	moduleInst    ModuleInstance     // 关联的实例
+	engCfg        *WorkNodeConfig    // 节点的 Engine 配置
+	logger        *nodeLogger        // 按节点日志配置过滤后的 Logger
+	input         chan *envelope     // 该节点的输入口, 输出口为该 Node 的下游接口, 该节点退出应该就自动释放
+	slots         chan struct{}      // 队列中的位置, 容量为 QueueSize, 消息被 Core 取走后释放
+	requeued      []*envelope        // pump 停止或暂停时放回的消息, 优先于 input 取出
+	requeueCh     chan struct{}      // 有消息放回时关闭
+	running       []*parallelContext // ctrl -> 控制每个 goroutine 是否退出, 主要是 parallels 的控制, 每个 parallels 可以独立控制是否退出，便于动态扩容起停
+	nodeQueue     *parallelContext   // 节点级别 MessageQueue 使用的 pump, 首次调用时创建
+	target        int                // 最近一次设置的 parallels 数量
+	downstream    []*moduleContext   // 下游节点
+	ctrlLock      sync.Mutex         // 保护 running、暂停状态与放回的消息
+	resumeCh      chan struct{}      // 暂停时创建, 恢复时关闭; 为 nil 表示未暂停
+	pausedCh      chan struct{}      // 暂停时关闭, 用于打断 pump 向 Core 交付消息
+	liveParallels atomic.Int32       // 仍在运行的 parallel 数量
+	drainedCh     chan struct{}      // 等待 parallel 全部退出时创建, 全部退出后关闭
+	initialized   atomic.Bool        // 实例的 Init 已成功, 停止时需要调用 Close
+	registered    bool               // 已启动并加入 Engine.nodes, 关闭时计入 Engine 的事件订阅状态
+	closeOnce     sync.Once
 	// ======= 统计计数器 =======
 	isRunning   bool
+	qpsLock     sync.RWMutex
 	recvCount   atomic.Uint64
 	sendCount   atomic.Uint64
+	errCount    atomic.Uint64
+	lastError   atomic.Value // string, 最近一次 Core 返回的错误
 	qpsOverflow bool
 	qpsSeek     int
 	recvQPS     []uint64
 	sendQPS     []uint64
+	// ======= 延迟统计 =======
+	queueLatency latencyHistogram // 入队 -> 被 Core 取走
+	nodeLatency  latencyHistogram // 被 Core 取走 -> Collect/ack
 }
 
 // Init 用于初始化一些帮助线程
@@ -62,7 +95,7 @@ func (m *moduleContext) Init() {
 }
 
 func (m *moduleContext) qpsMonitor() {
-	ticker := time.NewTicker(time.Second)
+	ticker := m.engine.clock.NewTicker(time.Second)
 	defer ticker.Stop()
 	lastSendCount := uint64(0)
 	lastRecvCount := uint64(0)
@@ -70,9 +103,10 @@ func (m *moduleContext) qpsMonitor() {
 		select {
 		case _ = <-m.ctx.Done():
 			return
-		case _ = <-ticker.C:
+		case _ = <-ticker.C():
 			curSendCount := m.sendCount.Load()
 			curRecvCount := m.recvCount.Load()
+			m.qpsLock.Lock()
 			m.recvQPS[m.qpsSeek] = curRecvCount - lastRecvCount
 			m.sendQPS[m.qpsSeek] = curSendCount - lastSendCount
 			lastRecvCount = curRecvCount
@@ -83,21 +117,21 @@ func (m *moduleContext) qpsMonitor() {
 				m.qpsOverflow = true
 				m.qpsSeek = 0
 			}
+			m.qpsLock.Unlock()
 		}
 	}
 }
+
+// GetQPS 返回最近每秒的接收与发送数量, 按时间从旧到新排列, 最后一项为最近一秒
 func (m *moduleContext) GetQPS() (recv, sent []uint64) {
-	size := m.qpsSeek
-	if size == 0 {
-		return []uint64{}, []uint64{}
-	}
-	if m.qpsOverflow {
-		size = m.engine.qpsArrayCap
+	m.qpsLock.RLock()
+	defer m.qpsLock.RUnlock()
+	if !m.qpsOverflow {
+		return append([]uint64{}, m.recvQPS[:m.qpsSeek]...), append([]uint64{}, m.sendQPS[:m.qpsSeek]...)
 	}
-	recv = make([]uint64, size)
-	sent = make([]uint64, size)
-	copy(recv, m.recvQPS[:size-1])
-	copy(sent, m.sendQPS[:size-1])
+	// 环已写满, qpsSeek 指向最旧的一项
+	recv = append(append(make([]uint64, 0, len(m.recvQPS)), m.recvQPS[m.qpsSeek:]...), m.recvQPS[:m.qpsSeek]...)
+	sent = append(append(make([]uint64, 0, len(m.sendQPS)), m.sendQPS[m.qpsSeek:]...), m.sendQPS[:m.qpsSeek]...)
 	return
 }
 
@@ -105,14 +139,32 @@ func (m *moduleContext) Name() string {
 	return m.name
 }
 
+func (m *moduleContext) NodeName() string {
+	return m.nodeName
+}
+
+func (m *moduleContext) ParallelIndex() int {
+	return -1
+}
+
 func (m *moduleContext) Logger() Logger {
-	return m.engine.logger
+	return m.logger
 }
 
 func (m *moduleContext) Collect(v interface{}) {
+	m.CollectWithContext(m.ctx, v)
+}
+
+func (m *moduleContext) CollectWithContext(ctx context.Context, v interface{}) {
+	if !m.waitResume(m.ctx) {
+		return
+	}
+	spanCtx := trace.SpanContextFromContext(ctx)
 	startAt := time.Now()
 	for _, down := range m.downstream {
-		down.input <- v
+		if !down.enqueue(m, v, spanCtx) {
+			return
+		}
 		consume := time.Now().Sub(startAt)
 		startAt = startAt.Add(consume)
 		if m.engine.slowThreshold > 0 && consume > m.engine.slowThreshold {
@@ -123,8 +175,21 @@ func (m *moduleContext) Collect(v interface{}) {
 	m.sendCount.Add(1)
 }
 
+// MessageQueue 节点级别的输入, 与各 parallel 一起消费节点队列中的消息
+// 首次调用时启动一个额外的 pump, 它取出的消息在被读走之前同样占用队列位置, 节点暂停或停止时放回队列
+// Core 应使用传给它的 ModuleContext 的 MessageQueue, 该 ModuleContext 会记录每条消息的延迟与 span
 func (m *moduleContext) MessageQueue() chan interface{} {
-	return m.input
+	m.ctrlLock.Lock()
+	defer m.ctrlLock.Unlock()
+	if m.nodeQueue == nil {
+		m.nodeQueue = newParallelContext(m, -1, nil)
+		go m.nodeQueue.pump(m.ctx)
+	}
+	return m.nodeQueue.output
+}
+
+func (m *moduleContext) Context() context.Context {
+	return m.ctx
 }
 
 func (m *moduleContext) GetModuleFactory() ModuleFactory {
@@ -134,3 +199,7 @@ func (m *moduleContext) GetModuleFactory() ModuleFactory {
 func (m *moduleContext) GetModuleInstance() ModuleInstance {
 	return m.moduleInst
 }
+
+func (m *moduleContext) Clock() Clock {
+	return m.engine.clock
+}
@@ -0,0 +1,236 @@
+package gpipe
+
+import (
+	"context"
+)
+
+// PauseNode 暂停节点: 该节点不再从队列中取出消息, 其 Collect 也会阻塞直到恢复
+func (e *Engine) PauseNode(name string) error {
+	node, err := e.getNode(name)
+	if err != nil {
+		return err
+	}
+	if node.pause() {
+		e.emit(EventNodePaused, name, -1, nil)
+	}
+	return nil
+}
+
+func (e *Engine) ResumeNode(name string) error {
+	node, err := e.getNode(name)
+	if err != nil {
+		return err
+	}
+	if node.resume() {
+		e.emit(EventNodeResumed, name, -1, nil)
+	}
+	return nil
+}
+
+// ScaleNode 调整节点的 parallels 数量, 缩容时从最后启动的 parallel 开始停止
+func (e *Engine) ScaleNode(name string, parallels int) error {
+	if parallels < 0 {
+		return newGPWError("invalid parallels %d", parallels)
+	}
+	node, err := e.getNode(name)
+	if err != nil {
+		return err
+	}
+	node.scale(parallels)
+	return nil
+}
+
+// StopNode 停止节点的所有 parallel, 队列中的消息会保留, 可通过 ScaleNode 重新启动
+func (e *Engine) StopNode(name string) error {
+	return e.ScaleNode(name, 0)
+}
+
+// RestartNode 停止节点当前的所有 parallel, 等待其全部退出后按最近一次设置的数量重新启动, 已自行退出的 parallel 也会重新启动
+// 若 ctx 结束时仍有 parallel 未退出, 节点将保持停止状态并返回 ctx 的错误
+func (e *Engine) RestartNode(ctx context.Context, name string) error {
+	node, err := e.getNode(name)
+	if err != nil {
+		return err
+	}
+	parallels := node.targetParallels()
+	node.scale(0)
+	if err := node.waitDrained(ctx); err != nil {
+		return err
+	}
+	node.scale(parallels)
+	e.emit(EventNodeRestarted, name, -1, nil)
+	return nil
+}
+
+func (e *Engine) getNode(name string) (*moduleContext, error) {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	if node, ok := e.nodes[name]; ok {
+		return node, nil
+	}
+	return nil, newGPWError("node %s not exists", name)
+}
+
+// pause 返回节点状态是否发生了变化
+func (m *moduleContext) pause() bool {
+	m.ctrlLock.Lock()
+	defer m.ctrlLock.Unlock()
+	if m.resumeCh != nil {
+		return false
+	}
+	m.resumeCh = make(chan struct{})
+	if m.pausedCh != nil {
+		close(m.pausedCh)
+		m.pausedCh = nil
+	}
+	return true
+}
+
+func (m *moduleContext) resume() bool {
+	m.ctrlLock.Lock()
+	defer m.ctrlLock.Unlock()
+	if m.resumeCh == nil {
+		return false
+	}
+	close(m.resumeCh)
+	m.resumeCh = nil
+	return true
+}
+
+func (m *moduleContext) isPaused() bool {
+	m.ctrlLock.Lock()
+	defer m.ctrlLock.Unlock()
+	return m.resumeCh != nil
+}
+
+// pauseSignal 返回节点暂停时关闭的 channel, 已暂停时返回已关闭的 channel
+func (m *moduleContext) pauseSignal() <-chan struct{} {
+	m.ctrlLock.Lock()
+	defer m.ctrlLock.Unlock()
+	if m.resumeCh != nil {
+		return closedCh
+	}
+	if m.pausedCh == nil {
+		m.pausedCh = make(chan struct{})
+	}
+	return m.pausedCh
+}
+
+var closedCh = func() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}()
+
+// waitResume 节点暂停时阻塞直到恢复, ctx 结束时返回 false
+func (m *moduleContext) waitResume(ctx context.Context) bool {
+	m.ctrlLock.Lock()
+	resumeCh := m.resumeCh
+	m.ctrlLock.Unlock()
+	if resumeCh == nil {
+		return true
+	}
+	select {
+	case _ = <-resumeCh:
+		return true
+	case _ = <-ctx.Done():
+		return false
+	}
+}
+
+func (m *moduleContext) parallels() int {
+	m.ctrlLock.Lock()
+	defer m.ctrlLock.Unlock()
+	return len(m.running)
+}
+
+// targetParallels 最近一次 scale 设置的 parallel 数量, 包括已自行退出的 parallel
+func (m *moduleContext) targetParallels() int {
+	m.ctrlLock.Lock()
+	defer m.ctrlLock.Unlock()
+	return m.target
+}
+
+// scale 启动或停止 parallel 直到数量为 parallels
+// 停止时等待 pump 将手中的消息放回队列后返回, 保证重新启动后消息的顺序不变
+func (m *moduleContext) scale(parallels int) {
+	m.ctrlLock.Lock()
+	m.target = parallels
+	for len(m.running) < parallels {
+		m.startParallelLocked(m.freeIndexLocked())
+	}
+	stopped := []*parallelContext{}
+	for len(m.running) > parallels {
+		last := len(m.running) - 1
+		m.running[last].cancel()
+		stopped = append(stopped, m.running[last])
+		m.running = m.running[:last]
+	}
+	m.ctrlLock.Unlock()
+	for _, pctx := range stopped {
+		<-pctx.done
+	}
+}
+
+func (m *moduleContext) startParallelLocked(index int) {
+	parallelsContext, parallelCancel := context.WithCancel(m.ctx)
+	pctx := newParallelContext(m, index, parallelCancel)
+	m.running = append(m.running, pctx)
+	m.parallelStarted(index)
+	go pctx.pump(parallelsContext)
+	go func() {
+		defer parallelCancel()
+		err := m.moduleInst.Core(parallelsContext, pctx)
+		if err != nil {
+			m.recordError(err)
+			m.engine.logger.Error(pctx, "module [%s] core error: %s", m.name, err)
+		}
+		m.removeParallel(pctx)
+		m.parallelExited(index, err)
+	}()
+}
+
+// removeParallel Core 自行退出的 parallel 不再计入 parallels, 之后的 ScaleNode / RestartNode 会重新启动它
+func (m *moduleContext) removeParallel(pctx *parallelContext) {
+	m.ctrlLock.Lock()
+	defer m.ctrlLock.Unlock()
+	for i, running := range m.running {
+		if running == pctx {
+			m.running = append(m.running[:i], m.running[i+1:]...)
+			return
+		}
+	}
+}
+
+// freeIndexLocked 返回运行中的 parallel 未使用的最小序号
+func (m *moduleContext) freeIndexLocked() int {
+	used := make(map[int]bool, len(m.running))
+	for _, running := range m.running {
+		used[running.index] = true
+	}
+	index := 0
+	for used[index] {
+		index++
+	}
+	return index
+}
+
+// waitDrained 等待节点所有的 parallel 退出
+func (m *moduleContext) waitDrained(ctx context.Context) error {
+	m.ctrlLock.Lock()
+	if m.liveParallels.Load() == 0 {
+		m.ctrlLock.Unlock()
+		return nil
+	}
+	if m.drainedCh == nil {
+		m.drainedCh = make(chan struct{})
+	}
+	drainedCh := m.drainedCh
+	m.ctrlLock.Unlock()
+	select {
+	case _ = <-drainedCh:
+		return nil
+	case _ = <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -6,64 +6,139 @@ import (
 	"fmt"
 	"github.com/goccy/go-graphviz"
 	"github.com/goccy/go-graphviz/cgraph"
-	"go.uber.org/zap"
-	"gopkg.in/yaml.v3"
+	"go.opentelemetry.io/otel/trace"
 	"io"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 )
 
 const (
 	defaultQPSArrayCap = 32
+	tracerName         = "github.com/nosuchperson/gpipe"
 )
 
 type Engine struct {
-	isRunning     bool
-	slowThreshold time.Duration
-	logger        Logger
-	dgaRoots      []*moduleContext
-	qpsArrayCap   int
+	isRunning         bool
+	slowThreshold     time.Duration
+	logger            Logger
+	logLevel          LogLevel // 仅对默认 logger 生效
+	lock              sync.RWMutex
+	dgaRoots          []*moduleContext
+	nodes             map[string]*moduleContext // 节点名 -> 节点, 用于运行时控制
+	qpsArrayCap       int
+	tracer            trace.Tracer // 为 nil 时不开启 tracing
+	secretResolvers   map[string]SecretResolver
+	flushTimeout      time.Duration // 调用 Flusher.Flush 的超时时间
+	nodeDefaults      NodeDefaults  // 节点未配置 queueSize / parallels 时的默认值
+	registry          *Registry     // 查找模块使用的注册表
+	configFormat      ConfigFormat  // 为空时根据文件扩展名或内容判断
+	configDir         string        // include 的相对路径基准, 为空时使用配置文件所在目录或当前目录
+	pluginDir         string        // 启动时从该目录加载 .so 插件, 为空时不加载
+	clock             Clock         // QPS 统计及模块使用的时钟
+	pluginsLock       sync.Mutex
+	pluginsLoaded     bool // 插件已全部加载成功, 失败时下次启动重试
+	eventsLock        sync.Mutex
+	subscribers       []chan Event
+	droppedEvents     atomic.Uint64
+	eventsStopped     bool // 已调用 Stop, 所有节点关闭后关闭订阅的 channel
+	eventsNodes       int  // Stop 时的节点数量
+	eventsNodesClosed int
+	eventsClosed      bool
 }
 
 func NewEngine(opts ...EngineOptions) *Engine {
 	engine := &Engine{
-		isRunning:     false,
-		slowThreshold: -1,
-		logger:        nil,
-		dgaRoots:      []*moduleContext{},
-		qpsArrayCap:   defaultQPSArrayCap,
+		isRunning:       false,
+		slowThreshold:   -1,
+		logger:          nil,
+		dgaRoots:        []*moduleContext{},
+		nodes:           map[string]*moduleContext{},
+		secretResolvers: defaultSecretResolvers(),
+		qpsArrayCap:     defaultQPSArrayCap,
+		nodeDefaults:    defaultNodeDefaults,
+		flushTimeout:    defaultFlushTimeout,
+		registry:        moduleRegister,
+		clock:           SystemClock(),
 	}
 	for _, opt := range opts {
 		opt(engine)
 	}
 	// default logger
 	if engine.logger == nil {
-		engine.logger = createDefaultLogger()
+		engine.logger = createDefaultLogger(engine.logLevel)
 	}
 
 	return engine
 }
 
 func (e *Engine) Run(ctx context.Context, cfg io.Reader) error {
-	if e.isRunning {
-		return ErrEngineIsRunning
-	}
-	configMap, err := e.loadConfig(cfg)
+	configMap, err := e.LoadConfig(cfg)
 	if err != nil {
 		return err
 	}
+	return e.start(ctx, configMap)
+}
+
+// RunConfig 使用代码中构造的 Config 启动, 与 Run 一样会展开子图、填充默认值并校验, 不会修改传入的 cfg
+func (e *Engine) RunConfig(ctx context.Context, cfg *Config) error {
+	if err := e.loadPlugins(); err != nil {
+		return err
+	}
+	configMap := cfg.clone()
+	configMap.registry = e.registry
+	if err := configMap.expandSubgraphs(); err != nil {
+		return configMap.RedactError(err)
+	}
+	configMap.applyDefaults(e.nodeDefaults)
+	if err := configMap.Valid(); err != nil {
+		return configMap.RedactError(err)
+	}
+	return e.start(ctx, configMap)
+}
+
+func (e *Engine) start(ctx context.Context, configMap *Config) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.isRunning {
+		return ErrEngineIsRunning
+	}
 
 	nodesMap := map[string]*moduleContext{}
+	roots := []*moduleContext{}
+	cancels := []context.CancelFunc{}
+	// abort 启动失败时停止已构造的节点, 并关闭其中已初始化的实例
+	abort := func(err error) error {
+		for _, cancel := range cancels {
+			cancel()
+		}
+		for _, node := range nodesMap {
+			node.closeInstance()
+		}
+		return configMap.RedactError(err)
+	}
 	for workerName, workerCfg := range e.listRootNodeMap(configMap.Engine) {
 		rootCtx, rootCancel := context.WithCancel(ctx)
+		cancels = append(cancels, rootCancel)
 		if node, err := e.prepareNode(&nodesMap, rootCtx, rootCancel, configMap.Engine, workerName, workerCfg); err != nil {
-			return err
+			return abort(err)
 		} else {
-			e.dgaRoots = append(e.dgaRoots, node)
+			roots = append(roots, node)
+		}
+	}
+	// 所有实例都初始化成功后才启动 parallel
+	for _, node := range bfsNodes(roots) {
+		if err := node.initInstance(); err != nil {
+			return abort(err)
 		}
 	}
+	e.dgaRoots = append(e.dgaRoots, roots...)
+	for _, node := range nodesMap {
+		node.registered = true
+		e.nodes[node.nodeName] = node
+	}
 	for _, root := range e.dgaRoots {
 		e.startNode(root)
 	}
@@ -72,17 +147,26 @@ func (e *Engine) Run(ctx context.Context, cfg io.Reader) error {
 }
 
 func (e *Engine) Stop() {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
 	for _, root := range e.dgaRoots {
 		root.stop()
 	}
+	e.emit(EventEngineStopped, "", -1, nil)
+	e.stopEvents(len(e.nodes))
+	// 此时已没有运行中 parallel 的节点不会再收到退出通知, 在这里关闭其实例
+	for _, node := range e.nodes {
+		go node.closeIfStopped()
+	}
 }
 
-func (e *Engine) loadConfig(cfg io.Reader) (*Config, error) {
-	configMap := &Config{}
-	if err := yaml.NewDecoder(cfg).Decode(&configMap); err != nil {
+// LoadConfig 解析并校验配置, 不会构造或启动任何节点
+// 配置中的 include / templates / ${...} 引用会在解析时展开, 返回的错误中不包含敏感信息
+func (e *Engine) LoadConfig(cfg io.Reader) (*Config, error) {
+	if err := e.loadPlugins(); err != nil {
 		return nil, err
 	}
-	return configMap, configMap.Valid()
+	return e.newConfigLoader(cfg).load(cfg)
 }
 
 // listRootNodeMap 获取所有根节点
@@ -107,26 +191,28 @@ func (e *Engine) prepareNode(nodesMap *map[string]*moduleContext, ctx context.Co
 	if err != nil {
 		return nil, err
 	}
-	zap.S().With("nodesMap", fmt.Sprintf("%p", nodesMap), "nodesMapValue", *nodesMap).Info("prepareNode")
-
 	node = &moduleContext{
-		engine:          e,
-		name:            curNodeName,
-		ctx:             ctx,
-		stop:            stop,
-		module:          modFactory,
-		moduleInst:      modInst,
-		engCfg:          nodeConfig,
-		input:           make(chan interface{}, nodeConfig.QueueSize),
-		parallelsCancel: make([]context.CancelFunc, 0, nodeConfig.Parallels),
-		downstream:      make([]*moduleContext, 0, 4),
-		isRunning:       false,
-		recvCount:       atomic.Uint64{},
-		sendCount:       atomic.Uint64{},
+		engine:     e,
+		name:       curNodeName,
+		nodeName:   nodeName,
+		ctx:        ctx,
+		stop:       stop,
+		module:     modFactory,
+		moduleInst: modInst,
+		engCfg:     nodeConfig,
+		logger:     newNodeLogger(e.logger, nodeConfig.Log),
+		input:      make(chan *envelope, nodeConfig.QueueSize),
+		slots:      make(chan struct{}, nodeConfig.QueueSize),
+		running:    make([]*parallelContext, 0, nodeConfig.Parallels),
+		downstream: make([]*moduleContext, 0, 4),
+		isRunning:  false,
+		recvCount:  atomic.Uint64{},
+		sendCount:  atomic.Uint64{},
 	}
 	node.Init()
 	(*nodesMap)[node.name] = node
-	zap.S().With("nodeName", node.Name(), "ptr", fmt.Sprintf("%p", node), "mapPtr", fmt.Sprintf("%p", nodesMap)).Info("Node built")
+	e.emit(EventNodeBuilt, nodeName, -1, nil)
+	e.logger.Trace(node, "node built")
 
 	for downstreamName, downstreamConfig := range e.getDownstreamNode(fullConfig, nodeName) {
 		if nodeContext, err := e.prepareNode(nodesMap, ctx, stop, fullConfig, downstreamName, downstreamConfig); err != nil {
@@ -140,7 +226,7 @@ func (e *Engine) prepareNode(nodesMap *map[string]*moduleContext, ctx context.Co
 }
 
 func (e *Engine) genNodeModule(nodeName string, nodeConfig *WorkNodeConfig) (ModuleFactory, ModuleInstance, error) {
-	modFactory, err := GetModuleByName(nodeConfig.Module)
+	modFactory, err := nodeConfig.moduleFactory(e.registry)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -156,15 +242,7 @@ func (e *Engine) startNode(node *moduleContext) {
 		return
 	}
 	node.isRunning = true
-	for i := 0; i < node.engCfg.Parallels; i++ {
-		parallelsContext, parallelCancel := context.WithCancel(node.ctx)
-		node.parallelsCancel = append(node.parallelsCancel, parallelCancel)
-		go func() {
-			if err := node.moduleInst.Core(parallelsContext, node); err != nil {
-				e.logger.Error(node, "module [%s] core error: %s", node.name, err)
-			}
-		}()
-	}
+	node.scale(node.engCfg.Parallels)
 	for _, downstream := range node.downstream {
 		e.startNode(downstream)
 	}
@@ -199,6 +277,27 @@ func (e *Engine) GraphState(outputFormat graphviz.Format) (string, error) {
 		node    *cgraph.Node
 	}
 
+	// 由子图展开的节点放在以子图实例名命名的 cluster 中, 嵌套的子图对应嵌套的 cluster
+	clusters := map[string]*cgraph.Graph{}
+	var getCluster func(instance string) *cgraph.Graph
+	getCluster = func(instance string) *cgraph.Graph {
+		if instance == "" {
+			return graph
+		} else if cluster, ok := clusters[instance]; ok {
+			return cluster
+		}
+		parent := graph
+		if idx := strings.LastIndex(instance, "."); idx > 0 {
+			parent = getCluster(instance[:idx])
+		}
+		cluster := parent.SubGraph("cluster_"+instance, 1)
+		cluster.SetLabel(instance)
+		clusters[instance] = cluster
+		return cluster
+	}
+
+	e.lock.RLock()
+	defer e.lock.RUnlock()
 	nameToNode := map[string]*tmpNode{}
 	nodes := append([]*moduleContext{}, e.dgaRoots...)
 	for len(nodes) > 0 {
@@ -209,7 +308,7 @@ func (e *Engine) GraphState(outputFormat graphviz.Format) (string, error) {
 			continue
 		}
 
-		if gnode, err := graph.CreateNode(node.name); err != nil {
+		if gnode, err := getCluster(node.engCfg.subgraph).CreateNode(node.name); err != nil {
 			return "", err
 		} else {
 			nameToNode[node.name] = &tmpNode{
@@ -230,15 +329,19 @@ func (e *Engine) GraphState(outputFormat graphviz.Format) (string, error) {
 				totalInQPS += inQPSArray[i]
 				totalOutQPS += outQPSArray[i]
 			}
-			gnode.SetLabel(fmt.Sprintf(`{ %s | {<c1> Receive | <c2> %d } | {<c1> QueueCap | <c2> %d } | {<c1> QueueSize | <c2> %d } | { <c1> InQPS | <c2> %0.2f } | { <c1> OutQPS | <c2> %0.2f } | { <c1> InQPSArray | <c2> %s } | { <c1> OutQPSArray | <c2> %s } }`,
+			queueLatency := node.queueLatency.Percentiles()
+			nodeLatency := node.nodeLatency.Percentiles()
+			gnode.SetLabel(fmt.Sprintf(`{ %s | {<c1> Receive | <c2> %d } | {<c1> QueueCap | <c2> %d } | {<c1> QueueSize | <c2> %d } | { <c1> InQPS | <c2> %0.2f } | { <c1> OutQPS | <c2> %0.2f } | { <c1> InQPSArray | <c2> %s } | { <c1> OutQPSArray | <c2> %s } | { <c1> QueueLatency p50/p95/p99 | <c2> %s / %s / %s } | { <c1> NodeLatency p50/p95/p99 | <c2> %s / %s / %s } }`,
 				node.Name(),
 				node.recvCount.Load(),
-				cap(node.input),
-				len(node.input),
+				node.queueCap(),
+				node.queueLen(),
 				float64(totalInQPS)/float64(len(inQPSArray)),
 				float64(totalOutQPS)/float64(len(outQPSArray)),
 				strings.Join(inQPSStr, " , "),
 				strings.Join(outQPSStr, " , "),
+				queueLatency.P50, queueLatency.P95, queueLatency.P99,
+				nodeLatency.P50, nodeLatency.P95, nodeLatency.P99,
 			))
 		}
 
@@ -264,3 +367,8 @@ func (e *Engine) GraphState(outputFormat graphviz.Format) (string, error) {
 		return buf.String(), nil
 	}
 }
+
+// Registry 返回 Engine 查找模块使用的注册表
+func (e *Engine) Registry() *Registry {
+	return e.registry
+}
@@ -83,7 +83,7 @@ func TestEngine_AddModule(t *testing.T) {
 	})); err != nil {
 		t.Fatal(err)
 	}
-	if _, ok := moduleRegister[modName]; !ok {
+	if _, err := moduleRegister.Get(modName); err != nil {
 		t.Fatal("Add module failed")
 	}
 }
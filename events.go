@@ -0,0 +1,132 @@
+package gpipe
+
+import (
+	"context"
+	"time"
+)
+
+const defaultEventsBufferSize = 256
+
+type EventType string
+
+const (
+	EventNodeBuilt       EventType = "nodeBuilt"       // 节点已构造完成
+	EventParallelStarted EventType = "parallelStarted" // 某个 parallel 开始运行
+	EventParallelExited  EventType = "parallelExited"  // 某个 parallel 退出, Err 为 Core 的返回值
+	EventNodeRestarted   EventType = "nodeRestarted"   // 节点通过 RestartNode 重启
+	EventNodePaused      EventType = "nodePaused"
+	EventNodeResumed     EventType = "nodeResumed"
+	EventNodeDrained     EventType = "nodeDrained"   // 节点的所有 parallel 均已退出
+	EventNodeClosed      EventType = "nodeClosed"    // 节点停止后已调用实例的 Flush / Close, Err 为其返回的错误
+	EventEngineStopped   EventType = "engineStopped" // 调用了 Engine.Stop, 之后仍可能收到各 parallel 的退出事件
+)
+
+// Event 引擎生命周期事件, Node 为配置中的节点名, 引擎级事件为空; Parallel 仅对 parallel 相关事件有效, 其余为 -1
+type Event struct {
+	Type     EventType
+	Node     string
+	Parallel int
+	Err      error
+	Time     time.Time
+}
+
+// Events 订阅生命周期事件, 每次调用返回一个新的 channel, ctx 结束时取消订阅并关闭 channel
+// Engine.Stop 之后所有节点的实例均已关闭时, 发出最后一个 nodeClosed 事件后关闭所有 channel
+// 事件的发送不会阻塞引擎, 订阅方消费过慢时多出的事件会被丢弃, 丢弃的数量可通过 DroppedEvents 获取
+func (e *Engine) Events(ctx context.Context) <-chan Event {
+	ch := make(chan Event, defaultEventsBufferSize)
+	e.eventsLock.Lock()
+	defer e.eventsLock.Unlock()
+	if e.eventsClosed {
+		close(ch)
+		return ch
+	}
+	e.subscribers = append(e.subscribers, ch)
+	context.AfterFunc(ctx, func() {
+		e.unsubscribe(ch)
+	})
+	return ch
+}
+
+// DroppedEvents 由于订阅方消费过慢而丢弃的事件数量, 每个订阅方分别计数
+func (e *Engine) DroppedEvents() uint64 {
+	return e.droppedEvents.Load()
+}
+
+func (e *Engine) unsubscribe(ch chan Event) {
+	e.eventsLock.Lock()
+	defer e.eventsLock.Unlock()
+	for i, sub := range e.subscribers {
+		if sub == ch {
+			e.subscribers = append(e.subscribers[:i], e.subscribers[i+1:]...)
+			close(ch)
+			return
+		}
+	}
+}
+
+func (e *Engine) emit(eventType EventType, node string, parallel int, err error) {
+	ev := Event{Type: eventType, Node: node, Parallel: parallel, Err: err, Time: time.Now()}
+	e.eventsLock.Lock()
+	defer e.eventsLock.Unlock()
+	for _, ch := range e.subscribers {
+		select {
+		case ch <- ev:
+		default:
+			e.droppedEvents.Add(1)
+		}
+	}
+}
+
+// stopEvents Engine.Stop 时记录需要关闭的节点数量, 全部关闭后关闭所有订阅的 channel
+func (e *Engine) stopEvents(nodes int) {
+	e.eventsLock.Lock()
+	defer e.eventsLock.Unlock()
+	e.eventsStopped = true
+	e.eventsNodes = nodes
+	e.closeEventsLocked()
+}
+
+// nodeClosed 节点的实例已关闭, 其 nodeClosed 事件已经发出
+func (e *Engine) nodeClosed() {
+	e.eventsLock.Lock()
+	defer e.eventsLock.Unlock()
+	e.eventsNodesClosed++
+	e.closeEventsLocked()
+}
+
+func (e *Engine) closeEventsLocked() {
+	if !e.eventsStopped || e.eventsNodesClosed < e.eventsNodes || e.eventsClosed {
+		return
+	}
+	for _, ch := range e.subscribers {
+		close(ch)
+	}
+	e.subscribers = nil
+	e.eventsClosed = true
+}
+
+// parallelStarted 节点的第一个 parallel 启动时视为模块启动
+func (m *moduleContext) parallelStarted(index int) {
+	if m.liveParallels.Add(1) == 1 {
+		m.engine.logger.ModuleStarted(m)
+	}
+	m.engine.emit(EventParallelStarted, m.nodeName, index, nil)
+}
+
+// parallelExited 节点的最后一个 parallel 退出时视为模块停止
+func (m *moduleContext) parallelExited(index int, err error) {
+	m.engine.emit(EventParallelExited, m.nodeName, index, err)
+	m.ctrlLock.Lock()
+	drained := m.liveParallels.Add(-1) == 0
+	if drained && m.drainedCh != nil {
+		close(m.drainedCh)
+		m.drainedCh = nil
+	}
+	m.ctrlLock.Unlock()
+	if drained {
+		m.engine.logger.ModuleStopped(m)
+		m.engine.emit(EventNodeDrained, m.nodeName, -1, nil)
+		m.closeIfStopped()
+	}
+}
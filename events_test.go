@@ -0,0 +1,149 @@
+package gpipe
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordLogger 只记录模块启停的 Logger
+type recordLogger struct {
+	lock    sync.Mutex
+	started []string
+	stopped []string
+}
+
+func (r *recordLogger) ModuleStarted(ctx ModuleContext) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.started = append(r.started, ctx.Name())
+}
+
+func (r *recordLogger) ModuleStopped(ctx ModuleContext) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.stopped = append(r.stopped, ctx.Name())
+}
+
+func (r *recordLogger) Info(ModuleContext, string, ...interface{})  {}
+func (r *recordLogger) Warn(ModuleContext, string, ...interface{})  {}
+func (r *recordLogger) Error(ModuleContext, string, ...interface{}) {}
+func (r *recordLogger) Trace(ModuleContext, string, ...interface{}) {}
+
+func waitEvent(t *testing.T, events <-chan Event, eventType EventType) Event {
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				t.Fatalf("events closed before %s", eventType)
+			}
+			if ev.Type == eventType {
+				return ev
+			}
+		case _ = <-time.After(time.Second):
+			t.Fatalf("event %s not received", eventType)
+		}
+	}
+}
+
+func TestEngine_Events(t *testing.T) {
+	modName := uuid.NewString()
+	assert.NoError(t, RegisterModule(NewSimpleModule(modName, func(name string, config interface{}) (ModuleInstance, error) {
+		return NewSimpleModuleInstance(modName, name, func(ctx context.Context, modCtx ModuleContext) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}), nil
+	})))
+	logger := &recordLogger{}
+	eng := NewEngine(EngineWithLogger(logger))
+	events := eng.Events(context.Background())
+	assert.NoError(t, eng.Run(context.Background(), strings.NewReader(fmt.Sprintf(`
+engine:
+  Worker:
+    module: %s
+    parent: [ ]
+    queueSize: 1
+    parallels: 2
+`, modName))))
+
+	assert.Equal(t, "Worker", waitEvent(t, events, EventNodeBuilt).Node)
+	waitEvent(t, events, EventParallelStarted)
+	waitEvent(t, events, EventParallelStarted)
+
+	assert.NoError(t, eng.PauseNode("Worker"))
+	waitEvent(t, events, EventNodePaused)
+	assert.NoError(t, eng.ResumeNode("Worker"))
+	waitEvent(t, events, EventNodeResumed)
+
+	assert.NoError(t, eng.RestartNode(context.Background(), "Worker"))
+	exited := waitEvent(t, events, EventParallelExited)
+	assert.ErrorIs(t, exited.Err, context.Canceled)
+	waitEvent(t, events, EventNodeDrained)
+	waitEvent(t, events, EventNodeRestarted)
+
+	eng.Stop()
+	waitEvent(t, events, EventEngineStopped)
+	waitEvent(t, events, EventNodeDrained)
+
+	logger.lock.Lock()
+	defer logger.lock.Unlock()
+	name := modName + "[Worker]"
+	assert.Equal(t, []string{name, name}, logger.started)
+	assert.Equal(t, []string{name, name}, logger.stopped)
+}
+
+func TestEngine_EventsClosed(t *testing.T) {
+	modName := uuid.NewString()
+	assert.NoError(t, RegisterModule(NewSimpleModule(modName, func(name string, config interface{}) (ModuleInstance, error) {
+		return NewSimpleModuleInstance(modName, name, func(ctx context.Context, modCtx ModuleContext) error {
+			<-ctx.Done()
+			return nil
+		}), nil
+	})))
+	eng := NewEngine(EngineWithLogLevel(LogLevelError))
+	ctx, cancel := context.WithCancel(context.Background())
+	unsubscribed := eng.Events(ctx)
+	events := eng.Events(context.Background())
+	assert.NoError(t, eng.Run(context.Background(), strings.NewReader(fmt.Sprintf(`
+engine:
+  Worker:
+    module: %s
+    parent: [ ]
+    queueSize: 1
+    parallels: 1
+`, modName))))
+	waitEvent(t, events, EventParallelStarted)
+
+	// ctx 结束后取消订阅, 不再收到事件
+	cancel()
+	assert.Eventually(t, func() bool {
+		for {
+			select {
+			case _, ok := <-unsubscribed:
+				if !ok {
+					return true
+				}
+			default:
+				return false
+			}
+		}
+	}, time.Second, time.Millisecond)
+
+	// 所有节点关闭后, 收到最后一个 nodeClosed 事件后 channel 被关闭
+	eng.Stop()
+	waitEvent(t, events, EventNodeClosed)
+	select {
+	case _, ok := <-events:
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("events not closed")
+	}
+	_, ok := <-eng.Events(context.Background())
+	assert.False(t, ok)
+	assert.Equal(t, uint64(0), eng.DroppedEvents())
+}
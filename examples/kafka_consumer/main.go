@@ -41,7 +41,7 @@ func main() {
 	cfg := `
 engine:
   source:
-    module: kafka-consumer
+    module: kafka/consumer
     parent: [ ]
     queueSize: 1
     parallels: 1
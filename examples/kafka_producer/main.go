@@ -43,7 +43,7 @@ func main() {
 	cfg := `
 engine:
   source:
-    module: interval
+    module: timer/interval
     parent: [ ]
     queueSize: 1
     parallels: 1
@@ -59,7 +59,7 @@ engine:
     config: {}
 
   sink:
-    module: kafka-producer
+    module: kafka/producer
     parent:
       - generate
     queueSize: 1
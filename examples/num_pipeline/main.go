@@ -2,11 +2,10 @@ package main
 
 import (
 	"context"
-	"fmt"
-	"github.com/goccy/go-graphviz"
 	"github.com/nosuchperson/gpipe"
+	"github.com/nosuchperson/gpipe/admin"
+	"net/http"
 	"os"
-	"time"
 )
 
 func main() {
@@ -22,14 +21,10 @@ func main() {
 	if err := eng.Run(context.Background(), fd); err != nil {
 		panic(err)
 	}
-	for i := 0; i < 10; i++ {
-		time.Sleep(time.Second * 5)
-		if str, err := eng.GraphState(graphviz.XDOT); err != nil {
-			fmt.Println(err)
-		} else {
-			fmt.Println(str)
-		}
+	defer eng.Stop()
+	// curl http://127.0.0.1:8080/gpipe/topology?format=dot
+	http.Handle("/gpipe/", http.StripPrefix("/gpipe", admin.NewHandler(eng)))
+	if err := http.ListenAndServe(":8080", nil); err != nil {
+		panic(err)
 	}
-	eng.Stop()
-	time.Sleep(time.Hour)
 }
@@ -0,0 +1,152 @@
+package gpipetest
+
+import (
+	"github.com/nosuchperson/gpipe"
+	"sync"
+	"time"
+)
+
+// FakeClock 实现 gpipe.Clock, 时间只在调用 Advance / Set 时前进
+//
+//	clock := gpipetest.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+//	h := gpipetest.Start(t, inst, gpipetest.WithClock(clock))
+//	clock.BlockUntil(1)          // 等待模块开始等待定时器
+//	clock.Advance(time.Second)   // 到期的定时器立即触发
+//	h.AssertOutputs(nil)
+type FakeClock struct {
+	lock    sync.Mutex
+	now     time.Time
+	waiters []*fakeWaiter
+	changed chan struct{} // 等待者数量变化时关闭并重建, 用于 BlockUntil
+}
+
+// fakeWaiter After 或 Ticker 创建的定时器, period 为 0 时只触发一次
+type fakeWaiter struct {
+	deadline time.Time
+	period   time.Duration
+	ch       chan time.Time
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now, changed: make(chan struct{})}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.addLocked(&fakeWaiter{deadline: c.now.Add(d), ch: ch})
+	return ch
+}
+
+func (c *FakeClock) NewTicker(d time.Duration) gpipe.Ticker {
+	if d <= 0 {
+		panic("non-positive interval for FakeClock.NewTicker")
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	w := &fakeWaiter{deadline: c.now.Add(d), period: d, ch: make(chan time.Time, 1)}
+	c.addLocked(w)
+	return &fakeTicker{clock: c, waiter: w}
+}
+
+// Advance 将时间推进 d, 按到期顺序触发期间到期的定时器, ticker 每个周期触发一次, 未被取走的 tick 会被丢弃
+func (c *FakeClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	target := c.now.Add(d)
+	for {
+		var next *fakeWaiter
+		for _, w := range c.waiters {
+			if !w.deadline.After(target) && (next == nil || w.deadline.Before(next.deadline)) {
+				next = w
+			}
+		}
+		if next == nil {
+			break
+		}
+		c.now = next.deadline
+		select {
+		case next.ch <- c.now:
+		default:
+		}
+		if next.period > 0 {
+			next.deadline = next.deadline.Add(next.period)
+		} else {
+			c.removeLocked(next)
+		}
+	}
+	c.now = target
+}
+
+// Set 将时间设置为 t, t 早于当前时间时不做任何事
+func (c *FakeClock) Set(t time.Time) {
+	if d := t.Sub(c.Now()); d > 0 {
+		c.Advance(d)
+	}
+}
+
+// Waiters 返回还未触发的 After 以及未停止的 Ticker 的数量
+func (c *FakeClock) Waiters() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.waiters)
+}
+
+// BlockUntil 阻塞直到等待中的定时器数量达到 n, 用于确认模块已经开始等待后再推进时间
+func (c *FakeClock) BlockUntil(n int) {
+	for {
+		c.lock.Lock()
+		count, changed := len(c.waiters), c.changed
+		c.lock.Unlock()
+		if count >= n {
+			return
+		}
+		<-changed
+	}
+}
+
+func (c *FakeClock) addLocked(w *fakeWaiter) {
+	c.waiters = append(c.waiters, w)
+	c.notifyLocked()
+}
+
+func (c *FakeClock) removeLocked(w *fakeWaiter) {
+	for i, waiter := range c.waiters {
+		if waiter == w {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			c.notifyLocked()
+			return
+		}
+	}
+}
+
+func (c *FakeClock) notifyLocked() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+type fakeTicker struct {
+	clock  *FakeClock
+	waiter *fakeWaiter
+}
+
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.waiter.ch
+}
+
+func (t *fakeTicker) Stop() {
+	t.clock.lock.Lock()
+	defer t.clock.lock.Unlock()
+	t.clock.removeLocked(t.waiter)
+}
@@ -0,0 +1,49 @@
+package gpipetest
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	assert.Equal(t, start, clock.Now())
+
+	after := clock.After(2 * time.Second)
+	ticker := clock.NewTicker(time.Second)
+	assert.Equal(t, 2, clock.Waiters())
+	assert.Equal(t, start, <-clock.After(0))
+
+	clock.Advance(time.Second)
+	assert.Equal(t, start.Add(time.Second), <-ticker.C())
+	assert.Empty(t, after)
+
+	// 未取走的 tick 被丢弃, After 按到期时间触发
+	clock.Advance(3 * time.Second)
+	assert.Equal(t, start.Add(4*time.Second), clock.Now())
+	assert.Equal(t, start.Add(2*time.Second), <-after)
+	assert.Equal(t, start.Add(2*time.Second), <-ticker.C())
+	assert.Empty(t, ticker.C())
+	assert.Equal(t, 1, clock.Waiters())
+
+	ticker.Stop()
+	assert.Equal(t, 0, clock.Waiters())
+	clock.Set(start)
+	assert.Equal(t, start.Add(4*time.Second), clock.Now())
+	clock.Set(start.Add(time.Minute))
+	assert.Equal(t, start.Add(time.Minute), clock.Now())
+}
+
+func TestFakeClock_BlockUntil(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	fired := make(chan struct{})
+	go func() {
+		<-clock.After(time.Hour)
+		close(fired)
+	}()
+	clock.BlockUntil(1)
+	clock.Advance(time.Hour)
+	<-fired
+}
@@ -0,0 +1,209 @@
+// Package gpipetest 提供编写模块单元测试所需的工具, 无需启动完整的 Engine
+//
+//	outputs := gpipetest.Run(t, inst, 1, 2, 3)
+//
+//	h := gpipetest.Start(t, inst)
+//	h.Feed(1, 2)
+//	h.AssertOutputs(2, 4)
+//	assert.NoError(t, h.Stop())
+package gpipetest
+
+import (
+	"context"
+	"fmt"
+	"github.com/nosuchperson/gpipe"
+	"strings"
+	"sync"
+)
+
+// LogEntry Context 捕获的一条日志
+type LogEntry struct {
+	Level   gpipe.LogLevel
+	Message string
+}
+
+func (l LogEntry) String() string {
+	return fmt.Sprintf("%s: %s", l.Level, l.Message)
+}
+
+// Context 实现 gpipe.ModuleContext, 输入由测试写入, Collect 的输出与日志均被记录
+type Context struct {
+	nodeName string
+	parallel int
+	factory  gpipe.ModuleFactory
+	instance gpipe.ModuleInstance
+	clock    gpipe.Clock
+	ctx      context.Context
+	input    chan interface{}
+
+	lock      sync.Mutex
+	outputs   []interface{}
+	logs      []LogEntry
+	collected chan struct{} // 每次 Collect 后关闭并重建, 用于等待输出
+}
+
+type Option func(c *Context)
+
+// WithNodeName 设置 NodeName / Name 返回的节点名, 默认为 test
+func WithNodeName(name string) Option {
+	return func(c *Context) {
+		c.nodeName = name
+	}
+}
+
+// WithParallelIndex 设置 ParallelIndex 的返回值, 默认为 0
+func WithParallelIndex(index int) Option {
+	return func(c *Context) {
+		c.parallel = index
+	}
+}
+
+// WithModuleFactory 设置 GetModuleFactory 的返回值, 日志中的模块名取自它
+func WithModuleFactory(factory gpipe.ModuleFactory) Option {
+	return func(c *Context) {
+		c.factory = factory
+	}
+}
+
+// WithClock 设置 Clock 的返回值, 默认为系统时钟, 测试定时类模块时使用 FakeClock
+func WithClock(clock gpipe.Clock) Option {
+	return func(c *Context) {
+		c.clock = clock
+	}
+}
+
+// NewContext 创建 Context, 输入队列不带缓冲, Feed 返回时消息已被模块取走
+func NewContext(inst gpipe.ModuleInstance, opts ...Option) *Context {
+	c := &Context{
+		nodeName:  "test",
+		instance:  inst,
+		clock:     gpipe.SystemClock(),
+		ctx:       context.Background(),
+		input:     make(chan interface{}),
+		collected: make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func (c *Context) Name() string {
+	return c.nodeName
+}
+
+func (c *Context) NodeName() string {
+	return c.nodeName
+}
+
+func (c *Context) ParallelIndex() int {
+	return c.parallel
+}
+
+func (c *Context) Logger() gpipe.Logger {
+	return &logger{c: c}
+}
+
+func (c *Context) MessageQueue() chan interface{} {
+	return c.input
+}
+
+func (c *Context) Collect(v interface{}) {
+	c.CollectWithContext(c.ctx, v)
+}
+
+func (c *Context) CollectWithContext(ctx context.Context, v interface{}) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.outputs = append(c.outputs, v)
+	close(c.collected)
+	c.collected = make(chan struct{})
+}
+
+func (c *Context) Context() context.Context {
+	return c.ctx
+}
+
+func (c *Context) GetModuleFactory() gpipe.ModuleFactory {
+	return c.factory
+}
+
+func (c *Context) GetModuleInstance() gpipe.ModuleInstance {
+	return c.instance
+}
+
+func (c *Context) Clock() gpipe.Clock {
+	return c.clock
+}
+
+// Feed 依次将消息写入输入队列, 每条消息被模块取走后才返回
+func (c *Context) Feed(inputs ...interface{}) {
+	for _, v := range inputs {
+		c.input <- v
+	}
+}
+
+// Outputs 返回目前为止 Collect 的所有输出
+func (c *Context) Outputs() []interface{} {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]interface{}{}, c.outputs...)
+}
+
+// Logs 返回目前为止记录的所有日志
+func (c *Context) Logs() []LogEntry {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]LogEntry{}, c.logs...)
+}
+
+// Logged 是否记录过 level 级别且包含 substr 的日志
+func (c *Context) Logged(level gpipe.LogLevel, substr string) bool {
+	for _, entry := range c.Logs() {
+		if entry.Level == level && strings.Contains(entry.Message, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+// waitOutputs 返回输出数量达到 n 之前的通知 channel, 已达到时返回 nil
+func (c *Context) waitOutputs(n int) <-chan struct{} {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if len(c.outputs) >= n {
+		return nil
+	}
+	return c.collected
+}
+
+func (c *Context) log(level gpipe.LogLevel, format string, args ...interface{}) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.logs = append(c.logs, LogEntry{Level: level, Message: fmt.Sprintf(format, args...)})
+}
+
+// logger 将日志记录到 Context 中
+type logger struct {
+	c *Context
+}
+
+func (l *logger) ModuleStarted(ctx gpipe.ModuleContext) {}
+
+func (l *logger) ModuleStopped(ctx gpipe.ModuleContext) {}
+
+func (l *logger) Info(ctx gpipe.ModuleContext, format string, args ...interface{}) {
+	l.c.log(gpipe.LogLevelInfo, format, args...)
+}
+
+func (l *logger) Warn(ctx gpipe.ModuleContext, format string, args ...interface{}) {
+	l.c.log(gpipe.LogLevelWarn, format, args...)
+}
+
+func (l *logger) Error(ctx gpipe.ModuleContext, format string, args ...interface{}) {
+	l.c.log(gpipe.LogLevelError, format, args...)
+}
+
+func (l *logger) Trace(ctx gpipe.ModuleContext, format string, args ...interface{}) {
+	l.c.log(gpipe.LogLevelTrace, format, args...)
+}
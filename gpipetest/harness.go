@@ -0,0 +1,144 @@
+package gpipetest
+
+import (
+	"context"
+	"github.com/nosuchperson/gpipe"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// DefaultTimeout 等待输出、等待 Core 退出的默认超时时间
+var DefaultTimeout = 5 * time.Second
+
+// Harness 在测试中运行单个 ModuleInstance, 按照 Engine 的顺序调用 Init / Core / Flush / Close
+type Harness struct {
+	t       testing.TB
+	ctx     *Context
+	inst    gpipe.ModuleInstance
+	cancel  context.CancelFunc
+	done    chan struct{}
+	err     error // Core 的返回值
+	stopped bool
+	Timeout time.Duration
+}
+
+// Start 调用实例的 Init 并在新的 goroutine 中运行 Core, Init 失败时测试立即失败
+func Start(t testing.TB, inst gpipe.ModuleInstance, opts ...Option) *Harness {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	modCtx := NewContext(inst, opts...)
+	modCtx.ctx = ctx
+	h := &Harness{t: t, ctx: modCtx, inst: inst, cancel: cancel, done: make(chan struct{}), Timeout: DefaultTimeout}
+	if initializer, ok := inst.(gpipe.Initializer); ok {
+		if err := initializer.Init(ctx); err != nil {
+			cancel()
+			t.Fatalf("init failed: %v", err)
+		}
+	}
+	go func() {
+		defer close(h.done)
+		h.err = inst.Core(ctx, modCtx)
+	}()
+	t.Cleanup(func() {
+		if !h.stopped {
+			h.Stop()
+		}
+	})
+	return h
+}
+
+// Run 启动实例, 依次输入 inputs 后停止, 返回所有输出; Core 返回错误时测试失败
+// 输入队列不带缓冲, 最后一条消息被取走后才停止, 因此同步处理消息的模块的输出是确定的
+func Run(t testing.TB, inst gpipe.ModuleInstance, inputs ...interface{}) []interface{} {
+	t.Helper()
+	h := Start(t, inst)
+	h.Feed(inputs...)
+	assert.NoError(t, h.Stop())
+	return h.ctx.Outputs()
+}
+
+// Context 返回实例使用的 ModuleContext
+func (h *Harness) Context() *Context {
+	return h.ctx
+}
+
+// Feed 依次输入消息, 每条消息被取走后才返回; Core 已退出或超时时测试失败
+func (h *Harness) Feed(inputs ...interface{}) {
+	h.t.Helper()
+	for i, v := range inputs {
+		select {
+		case h.ctx.input <- v:
+		case <-h.done:
+			h.t.Fatalf("core exited before input %d was consumed: %v", i, h.err)
+		case <-time.After(h.Timeout):
+			h.t.Fatalf("timeout waiting for input %d to be consumed", i)
+		}
+	}
+}
+
+// WaitOutputs 等待输出数量达到 n, 返回目前为止的所有输出; 超时或 Core 退出时测试失败
+func (h *Harness) WaitOutputs(n int) []interface{} {
+	h.t.Helper()
+	timeout := time.After(h.Timeout)
+	for {
+		ch := h.ctx.waitOutputs(n)
+		if ch == nil {
+			return h.ctx.Outputs()
+		}
+		select {
+		case <-ch:
+		case <-h.done:
+			if ch := h.ctx.waitOutputs(n); ch != nil {
+				h.t.Fatalf("core exited with %d outputs, want %d: %v", len(h.ctx.Outputs()), n, h.err)
+			}
+		case <-timeout:
+			h.t.Fatalf("timeout waiting for %d outputs, got %d", n, len(h.ctx.Outputs()))
+		}
+	}
+}
+
+// AssertOutputs 等待并检查输出与 expected 完全一致
+func (h *Harness) AssertOutputs(expected ...interface{}) bool {
+	h.t.Helper()
+	outputs := h.WaitOutputs(len(expected))
+	return assert.Equal(h.t, expected, outputs)
+}
+
+// AssertLogged 检查是否记录过 level 级别且包含 substr 的日志
+func (h *Harness) AssertLogged(level gpipe.LogLevel, substr string) bool {
+	h.t.Helper()
+	if h.ctx.Logged(level, substr) {
+		return true
+	}
+	return assert.Fail(h.t, "log not found", "no %s log contains %q in %v", level, substr, h.ctx.Logs())
+}
+
+// Done Core 退出后关闭
+func (h *Harness) Done() <-chan struct{} {
+	return h.done
+}
+
+// Stop 取消 ctx 并等待 Core 退出, 之后依次调用 Flush 与 Close, 返回 Core 的错误; 重复调用无效
+func (h *Harness) Stop() error {
+	h.t.Helper()
+	if h.stopped {
+		return h.err
+	}
+	h.stopped = true
+	h.cancel()
+	select {
+	case <-h.done:
+	case <-time.After(h.Timeout):
+		h.t.Fatalf("timeout waiting for core to exit")
+	}
+	if flusher, ok := h.inst.(gpipe.Flusher); ok {
+		ctx, cancel := context.WithTimeout(context.Background(), h.Timeout)
+		defer cancel()
+		assert.NoError(h.t, flusher.Flush(ctx), "flush")
+	}
+	if closer, ok := h.inst.(gpipe.Closer); ok {
+		assert.NoError(h.t, closer.Close(), "close")
+	}
+	return h.err
+}
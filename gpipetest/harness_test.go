@@ -0,0 +1,84 @@
+package gpipetest
+
+import (
+	"context"
+	"errors"
+	"github.com/nosuchperson/gpipe"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func double(ctx context.Context, modCtx gpipe.ModuleContext) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case v := <-modCtx.MessageQueue():
+			n, ok := v.(int)
+			if !ok {
+				modCtx.Logger().Error(modCtx, "invalid input %v", v)
+				continue
+			}
+			modCtx.Collect(n * 2)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	inst := gpipe.NewSimpleModuleInstance("double", "Double", double)
+	assert.Equal(t, []interface{}{2, 4, 6}, Run(t, inst, 1, 2, 3))
+}
+
+func TestHarness(t *testing.T) {
+	h := Start(t, gpipe.NewSimpleModuleInstance("double", "Double", double), WithNodeName("Double"))
+	assert.Equal(t, "Double", h.Context().NodeName())
+	h.Feed(1, "x", 2)
+	h.AssertOutputs(2, 4)
+	h.AssertLogged(gpipe.LogLevelError, "invalid input x")
+	assert.Equal(t, []LogEntry{{Level: gpipe.LogLevelError, Message: "invalid input x"}}, h.Context().Logs())
+	assert.NoError(t, h.Stop())
+	assert.NoError(t, h.Stop())
+}
+
+func TestHarness_Source(t *testing.T) {
+	h := Start(t, gpipe.NewSimpleModuleInstance("gen", "Gen", func(ctx context.Context, modCtx gpipe.ModuleContext) error {
+		for i := 0; i < 3; i++ {
+			modCtx.Collect(i)
+		}
+		return errors.New("done")
+	}))
+	<-h.Done()
+	assert.Equal(t, []interface{}{0, 1, 2}, h.WaitOutputs(3))
+	assert.EqualError(t, h.Stop(), "done")
+}
+
+type lifecycle struct {
+	calls []string
+}
+
+func (l *lifecycle) Init(ctx context.Context) error {
+	l.calls = append(l.calls, "init")
+	return nil
+}
+
+func (l *lifecycle) Core(ctx context.Context, modCtx gpipe.ModuleContext) error {
+	l.calls = append(l.calls, "core")
+	<-ctx.Done()
+	return nil
+}
+
+func (l *lifecycle) Flush(ctx context.Context) error {
+	l.calls = append(l.calls, "flush")
+	return nil
+}
+
+func (l *lifecycle) Close() error {
+	l.calls = append(l.calls, "close")
+	return nil
+}
+
+func TestHarness_Lifecycle(t *testing.T) {
+	inst := &lifecycle{}
+	Run(t, inst)
+	assert.Equal(t, []string{"init", "core", "flush", "close"}, inst.calls)
+}
@@ -0,0 +1,94 @@
+package gpipe
+
+import (
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// histSubBucketBits 每个 2 的幂区间再细分为 2^histSubBucketBits 份, 相对误差约 3%
+	histSubBucketBits  = 5
+	histSubBucketCount = 1 << histSubBucketBits
+	histBucketCount    = (64-histSubBucketBits-1)*histSubBucketCount + 2*histSubBucketCount
+)
+
+// latencyHistogram 一个简化的 HDR 风格直方图, 以微秒为单位累计记录, 可并发写入
+type latencyHistogram struct {
+	counts [histBucketCount]atomic.Uint64
+	total  atomic.Uint64
+	max    atomic.Uint64
+}
+
+// LatencyStats 直方图的分位数快照
+type LatencyStats struct {
+	Count uint64        `json:"count"`
+	P50   time.Duration `json:"p50"`
+	P95   time.Duration `json:"p95"`
+	P99   time.Duration `json:"p99"`
+	Max   time.Duration `json:"max"`
+}
+
+func histBucketIndex(v uint64) int {
+	shift := bits.Len64(v) - histSubBucketBits - 1
+	if shift < 0 {
+		shift = 0
+	}
+	return shift*histSubBucketCount + int(v>>uint(shift))
+}
+
+// histBucketValue 返回桶内的最大值, 与 HDR 的 highestEquivalentValue 一致
+func histBucketValue(idx int) uint64 {
+	if idx < 2*histSubBucketCount {
+		return uint64(idx)
+	}
+	shift := uint(idx/histSubBucketCount - 1)
+	m := uint64(idx%histSubBucketCount + histSubBucketCount)
+	return (m+1)<<shift - 1
+}
+
+func (h *latencyHistogram) Record(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	v := uint64(d.Microseconds())
+	h.counts[histBucketIndex(v)].Add(1)
+	h.total.Add(1)
+	for {
+		cur := h.max.Load()
+		if v <= cur || h.max.CompareAndSwap(cur, v) {
+			break
+		}
+	}
+}
+
+// Percentiles 计算 p50/p95/p99, 写入过程中调用时结果可能存在轻微偏差
+func (h *latencyHistogram) Percentiles() LatencyStats {
+	stats := LatencyStats{
+		Count: h.total.Load(),
+		Max:   time.Duration(h.max.Load()) * time.Microsecond,
+	}
+	if stats.Count == 0 {
+		return stats
+	}
+	targets := []struct {
+		p   float64
+		out *time.Duration
+	}{{0.50, &stats.P50}, {0.95, &stats.P95}, {0.99, &stats.P99}}
+	seen := uint64(0)
+	for idx := 0; idx < histBucketCount && len(targets) > 0; idx++ {
+		seen += h.counts[idx].Load()
+		for len(targets) > 0 && float64(seen) >= targets[0].p*float64(stats.Count) {
+			*targets[0].out = time.Duration(histBucketValue(idx)) * time.Microsecond
+			if *targets[0].out > stats.Max {
+				*targets[0].out = stats.Max
+			}
+			targets = targets[1:]
+		}
+	}
+	// 并发写入导致 total 大于各桶之和时, 余下的分位数取最大值
+	for _, t := range targets {
+		*t.out = stats.Max
+	}
+	return stats
+}
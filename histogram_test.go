@@ -0,0 +1,34 @@
+package gpipe
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestLatencyHistogram_Percentiles(t *testing.T) {
+	h := &latencyHistogram{}
+	assert.Equal(t, LatencyStats{}, h.Percentiles())
+	for i := 1; i <= 1000; i++ {
+		h.Record(time.Duration(i) * time.Millisecond)
+	}
+	stats := h.Percentiles()
+	assert.Equal(t, uint64(1000), stats.Count)
+	assert.Equal(t, time.Second, stats.Max)
+	// 桶的相对误差约 3%
+	assert.InEpsilon(t, float64(500*time.Millisecond), float64(stats.P50), 0.04)
+	assert.InEpsilon(t, float64(950*time.Millisecond), float64(stats.P95), 0.04)
+	assert.InEpsilon(t, float64(990*time.Millisecond), float64(stats.P99), 0.04)
+	assert.LessOrEqual(t, stats.P99, stats.Max)
+}
+
+func TestLatencyHistogram_BucketIndex(t *testing.T) {
+	for _, v := range []uint64{0, 1, 63, 64, 65, 1000, 123456789, 1<<63 + 1} {
+		idx := histBucketIndex(v)
+		assert.Less(t, idx, histBucketCount)
+		assert.GreaterOrEqual(t, histBucketValue(idx), v)
+		if idx > 0 {
+			assert.Less(t, histBucketValue(idx-1), v)
+		}
+	}
+}
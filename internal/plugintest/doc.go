@@ -0,0 +1,3 @@
+// Package plugintest 编译 testdata 下的插件并通过 gpipe.LoadPlugin 加载
+// 插件必须与宿主使用相同的 gpipe 包编译, 而 gpipe 自身的测试会将测试文件编译进包内, 因此放在单独的包中
+package plugintest
@@ -0,0 +1,88 @@
+//go:build (linux || darwin || freebsd) && cgo
+
+package plugintest
+
+import (
+	"context"
+	"github.com/nosuchperson/gpipe"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// buildPlugin 将 testdata/<name> 编译为 dir 下的 <name>.so
+func buildPlugin(t *testing.T, dir string, name string) string {
+	t.Helper()
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+	out := filepath.Join(dir, name+".so")
+	args := []string{"build", "-buildmode=plugin", "-o", out}
+	if raceEnabled {
+		args = append(args, "-race")
+	}
+	cmd := exec.Command(goBin, append(args, "./testdata/"+name)...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("build plugin %s failed: %v\n%s", name, err, output)
+	}
+	return out
+}
+
+// 同一个插件包在进程内只能打开一次, 因此每个插件只编译一次, 在同一个测试中覆盖各种情况
+func TestLoadPlugin(t *testing.T) {
+	if testing.Short() {
+		t.Skip("building plugins is slow")
+	}
+	dir := t.TempDir()
+	modules := buildPlugin(t, dir, "modules")
+	version := buildPlugin(t, dir, "version")
+	nilModule := buildPlugin(t, dir, "nilmodule")
+
+	registry := gpipe.NewRegistry()
+	err := gpipe.LoadPlugin(version, registry)
+	assert.ErrorContains(t, err, "plugin api version 2.0 is incompatible with "+gpipe.APIVersion)
+	assert.NoError(t, os.Remove(version))
+	// 目录中的 modules.so 先加载成功, nilmodule.so 加载失败
+	eng := gpipe.NewEngine(gpipe.EngineWithPluginDir(dir), gpipe.EngineWithRegistry(registry), gpipe.EngineWithLogLevel(gpipe.LogLevelError))
+	_, err = eng.Validate(strings.NewReader("engine: {}"))
+	assert.ErrorContains(t, err, "GpipeModules returned a nil module at index 1")
+	assert.Equal(t, []string{"fixture/echo"}, registry.List())
+	// 失败后再次启动会重试, 已加载的插件跳过已注册的模块
+	assert.NoError(t, os.Remove(nilModule))
+	_, err = eng.Validate(strings.NewReader("engine: {}"))
+	assert.NoError(t, err)
+	assert.NoError(t, gpipe.LoadPlugin(modules, registry))
+	assert.Equal(t, []string{"fixture/echo"}, registry.List())
+
+	recv := make(chan interface{}, 1)
+	assert.NoError(t, registry.Register(gpipe.NewSimpleModule("fixture/sink", func(name string, config interface{}) (gpipe.ModuleInstance, error) {
+		return gpipe.NewSimpleModuleInstance("fixture/sink", name, func(ctx context.Context, modCtx gpipe.ModuleContext) error {
+			recv <- <-modCtx.MessageQueue()
+			<-ctx.Done()
+			return nil
+		}), nil
+	})))
+	cfg, err := gpipe.NewPipeline().
+		Source("Source", gpipe.NewSimpleModuleInstance("fixture/source", "Source", func(ctx context.Context, modCtx gpipe.ModuleContext) error {
+			modCtx.Collect("hello")
+			<-ctx.Done()
+			return nil
+		}), nil).
+		Then("Echo", "fixture/echo", nil).
+		Then("Sink", "fixture/sink", nil).
+		Build()
+	assert.NoError(t, err)
+	assert.NoError(t, eng.RunConfig(context.Background(), cfg))
+	defer eng.Stop()
+	select {
+	case v := <-recv:
+		assert.Equal(t, "hello", v)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+}
@@ -0,0 +1,6 @@
+//go:build race
+
+package plugintest
+
+// raceEnabled 插件需要与测试程序使用相同的 -race 设置编译
+const raceEnabled = true
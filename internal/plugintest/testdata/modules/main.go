@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+	"github.com/nosuchperson/gpipe"
+)
+
+var GpipeAPIVersion = gpipe.APIVersion
+
+func GpipeModules() []gpipe.ModuleFactory {
+	return []gpipe.ModuleFactory{
+		gpipe.NewSimpleModule("fixture/echo", func(name string, config interface{}) (gpipe.ModuleInstance, error) {
+			return gpipe.NewSimpleModuleInstance("fixture/echo", name, func(ctx context.Context, modCtx gpipe.ModuleContext) error {
+				for {
+					select {
+					case <-ctx.Done():
+						return nil
+					case v := <-modCtx.MessageQueue():
+						modCtx.Collect(v)
+					}
+				}
+			}), nil
+		}),
+	}
+}
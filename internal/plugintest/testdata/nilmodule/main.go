@@ -0,0 +1,9 @@
+package main
+
+import "github.com/nosuchperson/gpipe"
+
+var GpipeAPIVersion = gpipe.APIVersion
+
+func GpipeModules() []gpipe.ModuleFactory {
+	return []gpipe.ModuleFactory{gpipe.NewSimpleModule("fixture/first", nil), nil}
+}
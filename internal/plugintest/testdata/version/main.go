@@ -0,0 +1,10 @@
+package main
+
+import "github.com/nosuchperson/gpipe"
+
+// GpipeAPIVersion 不兼容的 major 版本
+var GpipeAPIVersion = "2.0"
+
+func GpipeModules() []gpipe.ModuleFactory {
+	return []gpipe.ModuleFactory{gpipe.NewSimpleModule("fixture/version", nil)}
+}
@@ -0,0 +1,190 @@
+package gpipe
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const redactedSecret = "******"
+
+// SecretResolver 解析 ${scheme:ref} 形式的引用, 解析结果视为敏感信息, 不会出现在配置导出与错误信息中
+type SecretResolver interface {
+	Resolve(ref string) (string, error)
+}
+
+type SecretResolverFunc func(ref string) (string, error)
+
+func (f SecretResolverFunc) Resolve(ref string) (string, error) {
+	return f(ref)
+}
+
+var (
+	envReferencePattern    = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)(:-(.*))?$`)
+	secretReferencePattern = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9+.-]*):(.*)$`)
+)
+
+// defaultSecretResolvers 内置的 resolver: ${file:/run/secrets/x} 读取文件内容 (去除末尾换行), ${env:NAME} 读取环境变量
+func defaultSecretResolvers() map[string]SecretResolver {
+	return map[string]SecretResolver{
+		"file": SecretResolverFunc(func(ref string) (string, error) {
+			data, err := os.ReadFile(ref)
+			if err != nil {
+				return "", err
+			}
+			return strings.TrimRight(string(data), "\r\n"), nil
+		}),
+		"env": SecretResolverFunc(func(ref string) (string, error) {
+			if v, ok := os.LookupEnv(ref); ok {
+				return v, nil
+			}
+			return "", fmt.Errorf("environment variable %s is not set", ref)
+		}),
+	}
+}
+
+// interpolator 替换配置中所有标量值里的 ${...} 引用, 并记录解析出的敏感信息
+//
+//	${VAR} / ${VAR:-default}  环境变量, 未设置且没有默认值时报错
+//	${scheme:ref}             交由对应的 SecretResolver 解析
+//	$${                       转义, 输出字面量 ${
+type interpolator struct {
+	resolvers map[string]SecretResolver
+	secrets   []string
+}
+
+func (in *interpolator) interpolateNode(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, child := range node.Content {
+			if err := in.interpolateNode(child); err != nil {
+				return err
+			}
+		}
+	case yaml.MappingNode:
+		// 只处理 value, key 保持原样
+		for i := 1; i < len(node.Content); i += 2 {
+			if err := in.interpolateNode(node.Content[i]); err != nil {
+				return err
+			}
+		}
+	case yaml.ScalarNode:
+		if !strings.Contains(node.Value, "${") {
+			return nil
+		}
+		value, err := in.interpolate(node.Value)
+		if err != nil {
+			return newGPWError("line %d: %s", node.Line, err)
+		}
+		node.Value = value
+		// 替换后的值按字符串处理, 避免 "${PORT}" 之类的引号内容被重新推断类型
+		if node.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) != 0 {
+			node.Tag = "!!str"
+		} else {
+			node.Tag = ""
+		}
+	}
+	return nil
+}
+
+func (in *interpolator) interpolate(s string) (string, error) {
+	sb := strings.Builder{}
+	for {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			sb.WriteString(s)
+			return sb.String(), nil
+		}
+		if start > 0 && s[start-1] == '$' {
+			sb.WriteString(s[:start-1] + "${")
+			s = s[start+2:]
+			continue
+		}
+		end := strings.Index(s[start:], "}")
+		if end < 0 {
+			return "", fmt.Errorf("unterminated reference %q", s[start:])
+		}
+		value, err := in.resolve(s[start+2 : start+end])
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(s[:start] + value)
+		s = s[start+end+1:]
+	}
+}
+
+func (in *interpolator) resolve(ref string) (string, error) {
+	if m := envReferencePattern.FindStringSubmatch(ref); m != nil {
+		if v, ok := os.LookupEnv(m[1]); ok {
+			return v, nil
+		} else if m[2] != "" {
+			return m[3], nil
+		}
+		return "", fmt.Errorf("environment variable %s is not set", m[1])
+	}
+	if m := secretReferencePattern.FindStringSubmatch(ref); m != nil {
+		resolver, ok := in.resolvers[m[1]]
+		if !ok {
+			return "", fmt.Errorf("unknown secret resolver %s", m[1])
+		}
+		v, err := resolver.Resolve(m[2])
+		if err != nil {
+			return "", fmt.Errorf("resolve secret ${%s} failed: %v", ref, err)
+		}
+		if v != "" {
+			in.secrets = append(in.secrets, v)
+		}
+		return v, nil
+	}
+	return "", fmt.Errorf("invalid reference ${%s}", ref)
+}
+
+// redact 将字符串中出现的敏感信息替换为 ******
+func redact(s string, secrets []string) string {
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, redactedSecret)
+	}
+	return s
+}
+
+// redactError 错误信息中包含敏感信息时返回脱敏后的错误
+func redactError(err error, secrets []string) error {
+	if err == nil {
+		return nil
+	}
+	if msg := redact(err.Error(), secrets); msg != err.Error() {
+		return newGPWError("%s", msg)
+	}
+	return err
+}
+
+// redactNode 对节点树中所有标量值脱敏
+func redactNode(node *yaml.Node, secrets []string) {
+	if node.Kind == yaml.ScalarNode {
+		node.Value = redact(node.Value, secrets)
+	}
+	for _, child := range node.Content {
+		redactNode(child, secrets)
+	}
+}
+
+// Dump 以 YAML 格式导出配置, 其中由 SecretResolver 解析出的内容均被替换为 ******
+func (cfg *Config) Dump() (string, error) {
+	node := &yaml.Node{}
+	if err := node.Encode(cfg); err != nil {
+		return "", err
+	}
+	redactNode(node, cfg.secrets)
+	data, err := yaml.Marshal(node)
+	if err != nil {
+		return "", redactError(err, cfg.secrets)
+	}
+	return string(data), nil
+}
+
+// RedactError 将错误信息中的敏感信息替换为 ******
+func (cfg *Config) RedactError(err error) error {
+	return redactError(err, cfg.secrets)
+}
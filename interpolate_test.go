@@ -0,0 +1,110 @@
+package gpipe
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEngine_LoadConfigInterpolation(t *testing.T) {
+	t.Setenv("GPIPE_TEST_BROKER", "kafka:9092")
+	t.Setenv("GPIPE_TEST_QUEUE", "8")
+	t.Setenv("GPIPE_TEST_PASSWORD", "env-secret")
+	secretFile := filepath.Join(t.TempDir(), "password")
+	assert.NoError(t, os.WriteFile(secretFile, []byte("file-secret\n"), 0600))
+
+	eng := NewEngine(EngineWithSecretResolver("vault", SecretResolverFunc(func(ref string) (string, error) {
+		return "vault-" + ref, nil
+	})))
+	cfg, err := eng.LoadConfig(strings.NewReader(`
+engine:
+  Consumer:
+    module: kafka/consumer
+    parent: [ ]
+    queueSize: ${GPIPE_TEST_QUEUE}
+    parallels: ${GPIPE_TEST_UNSET:-2}
+    config:
+      brokers: "${GPIPE_TEST_BROKER}"
+      port: "${GPIPE_TEST_QUEUE}"
+      password: ${file:` + secretFile + `}
+      token: ${env:GPIPE_TEST_PASSWORD}
+      apiKey: key=${vault:kafka/api}
+      literal: $${GPIPE_TEST_BROKER}
+`))
+	assert.NoError(t, err)
+	node := cfg.Engine["Consumer"]
+	assert.Equal(t, 8, node.QueueSize)
+	assert.Equal(t, 2, node.Parallels)
+	assert.Equal(t, map[string]interface{}{
+		"brokers":  "kafka:9092",
+		"port":     "8",
+		"password": "file-secret",
+		"token":    "env-secret",
+		"apiKey":   "key=vault-kafka/api",
+		"literal":  "${GPIPE_TEST_BROKER}",
+	}, node.Config)
+
+	dump, err := cfg.Dump()
+	assert.NoError(t, err)
+	assert.Contains(t, dump, "kafka:9092")
+	assert.Contains(t, dump, "apiKey: key=******")
+	for _, secret := range []string{"file-secret", "env-secret", "vault-kafka/api"} {
+		assert.NotContains(t, dump, secret)
+	}
+}
+
+func TestEngine_LoadConfigInterpolationError(t *testing.T) {
+	eng := NewEngine(EngineWithSecretResolver("vault", SecretResolverFunc(func(ref string) (string, error) {
+		return "s3cr3t", nil
+	})))
+	for cfg, msg := range map[string]string{
+		"module: ${GPIPE_TEST_UNSET}":   "line 4: environment variable GPIPE_TEST_UNSET is not set",
+		"module: ${unknown:ref}":        "line 4: unknown secret resolver unknown",
+		"module: ${file:/not/exists}":   "line 4: resolve secret ${file:/not/exists} failed",
+		"module: ${GPIPE_TEST_UNSET":    "line 4: unterminated reference",
+		"module: ${bad ref}":            "line 4: invalid reference ${bad ref}",
+		"parent: [ '${vault:parent}' ]": "worker Node has invalid parent ******",
+	} {
+		_, err := eng.LoadConfig(strings.NewReader(`
+engine:
+  Node:
+    ` + cfg + `
+`))
+		if assert.Error(t, err, cfg) {
+			assert.Contains(t, err.Error(), msg)
+			assert.NotContains(t, err.Error(), "s3cr3t")
+		}
+	}
+}
+
+func TestEngine_LoadConfigInterpolationTemplate(t *testing.T) {
+	t.Setenv("GPIPE_TEST_BROKER", "kafka:9092")
+	// 继承同一个模板的多个节点只插值一次, 转义与解析出的值不会被再次展开
+	t.Setenv("GPIPE_TEST_NESTED", "$${GPIPE_TEST_BROKER}")
+	cfg, err := NewEngine().LoadConfig(strings.NewReader(`
+templates:
+  base:
+    module: kafka/consumer
+    config:
+      pattern: "$${literal}"
+      nested: ${GPIPE_TEST_NESTED}
+      brokers: ${GPIPE_TEST_BROKER}
+engine:
+  First:
+    extends: base
+    parent: [ ]
+  Second:
+    extends: base
+    parent: [ ]
+`))
+	assert.NoError(t, err)
+	for _, name := range []string{"First", "Second"} {
+		assert.Equal(t, map[string]interface{}{
+			"pattern": "${literal}",
+			"nested":  "$${GPIPE_TEST_BROKER}",
+			"brokers": "kafka:9092",
+		}, cfg.Engine[name].Config, name)
+	}
+}
@@ -0,0 +1,70 @@
+package gpipe
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const defaultFlushTimeout = 10 * time.Second
+
+// Initializer ModuleInstance 可选实现的接口, 在节点的任何 parallel 启动前调用一次, 返回错误时 Run 失败
+type Initializer interface {
+	Init(ctx context.Context) error
+}
+
+// Flusher ModuleInstance 可选实现的接口, 节点停止且所有 parallel 退出后、Close 之前调用一次
+type Flusher interface {
+	Flush(ctx context.Context) error
+}
+
+// Closer ModuleInstance 可选实现的接口, 节点停止且所有 parallel 退出后调用一次, 用于释放 Init 中创建的资源
+// 实现了 Initializer 的实例只有在 Init 成功后才会调用 Close
+type Closer interface {
+	Close() error
+}
+
+// initInstance 调用实例的 Init
+func (m *moduleContext) initInstance() error {
+	if initializer, ok := m.moduleInst.(Initializer); ok {
+		if err := initializer.Init(m.ctx); err != nil {
+			return newGPWError("worker %s init failed: %s", m.nodeName, err)
+		}
+	}
+	m.initialized.Store(true)
+	return nil
+}
+
+// closeInstance 依次调用实例的 Flush 与 Close, 每个节点只执行一次, Init 未成功的实例直接跳过
+func (m *moduleContext) closeInstance() {
+	m.closeOnce.Do(func() {
+		if m.registered {
+			defer m.engine.nodeClosed()
+		}
+		if _, ok := m.moduleInst.(Initializer); ok && !m.initialized.Load() {
+			return
+		}
+		var flushErr, closeErr error
+		if flusher, ok := m.moduleInst.(Flusher); ok {
+			ctx, cancel := context.WithTimeout(context.Background(), m.engine.flushTimeout)
+			flushErr = flusher.Flush(ctx)
+			cancel()
+		}
+		if closer, ok := m.moduleInst.(Closer); ok {
+			closeErr = closer.Close()
+		}
+		err := errors.Join(flushErr, closeErr)
+		if err != nil {
+			m.recordError(err)
+			m.engine.logger.Error(m, "module [%s] close error: %s", m.name, err)
+		}
+		m.engine.emit(EventNodeClosed, m.nodeName, -1, err)
+	})
+}
+
+// closeIfStopped 节点已停止且没有运行中的 parallel 时关闭实例
+func (m *moduleContext) closeIfStopped() {
+	if m.ctx.Err() != nil && m.liveParallels.Load() == 0 {
+		m.closeInstance()
+	}
+}
@@ -0,0 +1,116 @@
+package gpipe
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+)
+
+// lifecycleInstance 记录生命周期函数的调用顺序
+type lifecycleInstance struct {
+	lock    sync.Mutex
+	calls   []string
+	initErr error
+	closeCh chan struct{}
+}
+
+func (l *lifecycleInstance) record(call string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.calls = append(l.calls, call)
+}
+
+func (l *lifecycleInstance) recorded() []string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return append([]string{}, l.calls...)
+}
+
+func (l *lifecycleInstance) Init(ctx context.Context) error {
+	l.record("init")
+	return l.initErr
+}
+
+func (l *lifecycleInstance) Core(ctx context.Context, modCtx ModuleContext) error {
+	l.record("core")
+	<-ctx.Done()
+	return nil
+}
+
+func (l *lifecycleInstance) Flush(ctx context.Context) error {
+	l.record("flush")
+	return nil
+}
+
+func (l *lifecycleInstance) Close() error {
+	l.record("close")
+	return newGPWError("close failed")
+}
+
+func TestEngine_Lifecycle(t *testing.T) {
+	source, sink, stopped := &lifecycleInstance{}, &lifecycleInstance{}, &lifecycleInstance{}
+	cfg, err := NewPipeline().
+		Source("Source", source, nil, NodeWithParallels(2)).
+		Then("Sink", sink, nil).
+		From("Source").Then("Stopped", stopped, nil).
+		Build()
+	assert.NoError(t, err)
+
+	eng := NewEngine()
+	events := eng.Events(context.Background())
+	assert.NoError(t, eng.RunConfig(context.Background(), cfg))
+	waitEvent(t, events, EventParallelStarted)
+	assert.NoError(t, eng.StopNode("Stopped"))
+	ev := waitEvent(t, events, EventNodeDrained)
+	assert.Equal(t, "Stopped", ev.Node)
+	// 通过 StopNode 停止的节点之后还可以重新启动, 此时不应关闭实例
+	assert.Equal(t, []string{"init", "core"}, stopped.recorded())
+
+	eng.Stop()
+	closed := map[string]error{}
+	for len(closed) < 3 {
+		ev := waitEvent(t, events, EventNodeClosed)
+		closed[ev.Node] = ev.Err
+	}
+	assert.EqualError(t, closed["Source"], "close failed")
+	assert.Equal(t, []string{"init", "core", "core", "flush", "close"}, source.recorded())
+	assert.Equal(t, []string{"init", "core", "flush", "close"}, sink.recorded())
+	assert.Equal(t, []string{"init", "core", "flush", "close"}, stopped.recorded())
+	for _, stats := range eng.Stats() {
+		assert.Equal(t, "close failed", stats.LastError)
+	}
+}
+
+func TestEngine_LifecycleInitError(t *testing.T) {
+	first, broken, last := &lifecycleInstance{}, &lifecycleInstance{initErr: newGPWError("no connection")}, &lifecycleInstance{}
+	cfg, err := NewPipeline().
+		Source("First", first, nil).
+		Then("Broken", broken, nil).
+		Then("Last", last, nil).
+		Build()
+	assert.NoError(t, err)
+
+	eng := NewEngine()
+	err = eng.RunConfig(context.Background(), cfg)
+	assert.EqualError(t, err, "worker Broken init failed: no connection")
+	assert.Equal(t, []string{"init", "flush", "close"}, first.recorded())
+	assert.Equal(t, []string{"init"}, broken.recorded())
+	assert.Empty(t, last.recorded())
+	assert.Empty(t, eng.Stats())
+
+	// 直接传入的实例只能使用一次, 已关闭的实例不会被再次启动
+	err = eng.RunConfig(context.Background(), cfg)
+	assert.ErrorContains(t, err, "instance of worker First has already been used")
+	assert.Equal(t, []string{"init", "flush", "close"}, first.recorded())
+
+	// 启动失败后 Engine 可以使用新的实例再次启动
+	cfg, err = NewPipeline().
+		Source("First", &lifecycleInstance{}, nil).
+		Then("Broken", &lifecycleInstance{}, nil).
+		Then("Last", &lifecycleInstance{}, nil).
+		Build()
+	assert.NoError(t, err)
+	assert.NoError(t, eng.RunConfig(context.Background(), cfg))
+	eng.Stop()
+}
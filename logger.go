@@ -1,10 +1,15 @@
 package gpipe
 
 import (
+	"context"
+	"fmt"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"log/slog"
+	"strings"
 )
 
+// Logger 引擎及模块使用的日志接口, ModuleContext 为 nil 时表示引擎自身的日志
 type Logger interface {
 	ModuleStarted(ctx ModuleContext)
 	ModuleStopped(ctx ModuleContext)
@@ -14,35 +19,164 @@ type Logger interface {
 	Trace(ModuleContext, string, ...interface{})
 }
 
-type defaultLogger struct {
-	log *zap.Logger
+type LogLevel int
+
+const (
+	LogLevelTrace LogLevel = iota
+	LogLevelInfo
+	LogLevelWarn
+	LogLevelError
+)
+
+var logLevelNames = map[LogLevel]string{
+	LogLevelTrace: "trace",
+	LogLevelInfo:  "info",
+	LogLevelWarn:  "warn",
+	LogLevelError: "error",
+}
+
+func (l LogLevel) String() string {
+	if name, ok := logLevelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("LogLevel(%d)", int(l))
+}
+
+func ParseLogLevel(s string) (LogLevel, error) {
+	for level, name := range logLevelNames {
+		if strings.EqualFold(s, name) {
+			return level, nil
+		}
+	}
+	return 0, newGPWError("unknown log level %s", s)
+}
+
+// logFields 提取日志的结构化字段: 节点名、模块名以及 parallel 序号 (节点级别为 -1)
+func logFields(ctx ModuleContext) (node, module string, parallel int, ok bool) {
+	if ctx == nil {
+		return "", "", -1, false
+	}
+	if factory := ctx.GetModuleFactory(); factory != nil {
+		module = factory.Name()
+	}
+	return ctx.NodeName(), module, ctx.ParallelIndex(), true
+}
+
+// zapLogger 将 Logger 适配到 zap, Trace 对应 zap 的 Debug
+type zapLogger struct {
+	log   *zap.Logger
+	level LogLevel
+}
+
+// NewZapLogger 日志的调用位置为调用 Logger 方法的代码, 需要在 log 上开启 zap.AddCaller
+func NewZapLogger(log *zap.Logger, level LogLevel) Logger {
+	// 跳过 logf 与 Info 等方法两层
+	return &zapLogger{log: log.WithOptions(zap.AddCallerSkip(2)), level: level}
+}
+
+// callerSkipper 可以调整调用位置的 Logger, 被其他 Logger 包装时用于跳过包装层
+type callerSkipper interface {
+	withCallerSkip(skip int) Logger
+}
+
+func (z *zapLogger) withCallerSkip(skip int) Logger {
+	return &zapLogger{log: z.log.WithOptions(zap.AddCallerSkip(skip)), level: z.level}
+}
+
+func (z *zapLogger) fields(ctx ModuleContext) []zap.Field {
+	node, module, parallel, ok := logFields(ctx)
+	if !ok {
+		return nil
+	}
+	fields := []zap.Field{zap.String("node", node), zap.String("module", module)}
+	if parallel >= 0 {
+		fields = append(fields, zap.Int("parallel", parallel))
+	}
+	return fields
+}
+
+func (z *zapLogger) logf(level LogLevel, zapLevel zapcore.Level, ctx ModuleContext, s string, i ...interface{}) {
+	if level < z.level {
+		return
+	}
+	if ce := z.log.Check(zapLevel, fmt.Sprintf(s, i...)); ce != nil {
+		ce.Write(z.fields(ctx)...)
+	}
+}
+
+func (z *zapLogger) ModuleStarted(ctx ModuleContext) {
+	z.logf(LogLevelInfo, zapcore.InfoLevel, ctx, "module started")
+}
+
+func (z *zapLogger) ModuleStopped(ctx ModuleContext) {
+	z.logf(LogLevelInfo, zapcore.InfoLevel, ctx, "module stopped")
+}
+
+func (z *zapLogger) Info(ctx ModuleContext, s string, i ...interface{}) {
+	z.logf(LogLevelInfo, zapcore.InfoLevel, ctx, s, i...)
+}
+
+func (z *zapLogger) Warn(ctx ModuleContext, s string, i ...interface{}) {
+	z.logf(LogLevelWarn, zapcore.WarnLevel, ctx, s, i...)
+}
+
+func (z *zapLogger) Error(ctx ModuleContext, s string, i ...interface{}) {
+	z.logf(LogLevelError, zapcore.ErrorLevel, ctx, s, i...)
+}
+
+func (z *zapLogger) Trace(ctx ModuleContext, s string, i ...interface{}) {
+	z.logf(LogLevelTrace, zapcore.DebugLevel, ctx, s, i...)
+}
+
+// slogLogger 将 Logger 适配到 log/slog, Trace 对应 slog 的 Debug
+type slogLogger struct {
+	log   *slog.Logger
+	level LogLevel
+}
+
+func NewSlogLogger(log *slog.Logger, level LogLevel) Logger {
+	return &slogLogger{log: log, level: level}
+}
+
+func (l *slogLogger) logf(level LogLevel, slogLevel slog.Level, ctx ModuleContext, s string, i ...interface{}) {
+	if level < l.level || !l.log.Enabled(context.Background(), slogLevel) {
+		return
+	}
+	attrs := []slog.Attr{}
+	if node, module, parallel, ok := logFields(ctx); ok {
+		attrs = append(attrs, slog.String("node", node), slog.String("module", module))
+		if parallel >= 0 {
+			attrs = append(attrs, slog.Int("parallel", parallel))
+		}
+	}
+	l.log.LogAttrs(context.Background(), slogLevel, fmt.Sprintf(s, i...), attrs...)
 }
 
-func (d *defaultLogger) ModuleStarted(ctx ModuleContext) {
-	d.log.Sugar().With("module", ctx.Name()).Info("module started")
+func (l *slogLogger) ModuleStarted(ctx ModuleContext) {
+	l.logf(LogLevelInfo, slog.LevelInfo, ctx, "module started")
 }
 
-func (d *defaultLogger) ModuleStopped(ctx ModuleContext) {
-	d.log.Sugar().With("module", ctx.Name()).Info("module stopped")
+func (l *slogLogger) ModuleStopped(ctx ModuleContext) {
+	l.logf(LogLevelInfo, slog.LevelInfo, ctx, "module stopped")
 }
 
-func (d *defaultLogger) Info(context ModuleContext, s string, i ...interface{}) {
-	d.log.Sugar().With("module", context.Name()).Infof(s, i...)
+func (l *slogLogger) Info(ctx ModuleContext, s string, i ...interface{}) {
+	l.logf(LogLevelInfo, slog.LevelInfo, ctx, s, i...)
 }
 
-func (d *defaultLogger) Warn(context ModuleContext, s string, i ...interface{}) {
-	d.log.Sugar().With("module", context.Name()).Warnf(s, i...)
+func (l *slogLogger) Warn(ctx ModuleContext, s string, i ...interface{}) {
+	l.logf(LogLevelWarn, slog.LevelWarn, ctx, s, i...)
 }
 
-func (d *defaultLogger) Error(context ModuleContext, s string, i ...interface{}) {
-	d.log.Sugar().With("module", context.Name()).Errorf(s, i...)
+func (l *slogLogger) Error(ctx ModuleContext, s string, i ...interface{}) {
+	l.logf(LogLevelError, slog.LevelError, ctx, s, i...)
 }
 
-func (d *defaultLogger) Trace(context ModuleContext, s string, i ...interface{}) {
-	d.log.Sugar().With("module", context.Name()).Debugf(s, i...)
+func (l *slogLogger) Trace(ctx ModuleContext, s string, i ...interface{}) {
+	l.logf(LogLevelTrace, slog.LevelDebug, ctx, s, i...)
 }
 
-func createDefaultLogger() Logger {
+func createDefaultLogger(level LogLevel) Logger {
 	zc := zap.Config{
 		Level:             zap.NewAtomicLevelAt(zapcore.DebugLevel),
 		Development:       true,
@@ -71,6 +205,6 @@ func createDefaultLogger() Logger {
 	if lg, err := zc.Build(); err != nil {
 		panic(err)
 	} else {
-		return &defaultLogger{log: lg}
+		return NewZapLogger(lg, level)
 	}
 }
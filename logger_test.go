@@ -0,0 +1,83 @@
+package gpipe
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"log/slog"
+	"runtime"
+	"testing"
+)
+
+func newLoggerTestContext() (*moduleContext, *parallelContext) {
+	node := &moduleContext{
+		name:     "test/logger[Node]",
+		nodeName: "Node",
+		module:   NewSimpleModule("test/logger", nil),
+	}
+	return node, newParallelContext(node, 3, nil)
+}
+
+func TestZapLogger(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	logger := NewZapLogger(zap.New(core), LogLevelInfo)
+	node, parallel := newLoggerTestContext()
+
+	logger.Trace(parallel, "dropped %d", 1)
+	logger.Info(parallel, "hello %s", "world")
+	logger.Warn(node, "node level")
+	logger.Error(nil, "engine level")
+
+	entries := logs.AllUntimed()
+	assert.Equal(t, 3, len(entries))
+	assert.Equal(t, "hello world", entries[0].Message)
+	assert.Equal(t, map[string]interface{}{"node": "Node", "module": "test/logger", "parallel": int64(3)}, entries[0].ContextMap())
+	assert.Equal(t, zapcore.WarnLevel, entries[1].Level)
+	assert.Equal(t, map[string]interface{}{"node": "Node", "module": "test/logger"}, entries[1].ContextMap())
+	assert.Empty(t, entries[2].ContextMap())
+}
+
+func TestZapLogger_Caller(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	logger := NewZapLogger(zap.New(core, zap.AddCaller()), LogLevelInfo)
+	_, parallel := newLoggerTestContext()
+
+	_, file, line, _ := runtime.Caller(0)
+	logger.Info(parallel, "direct")
+	newNodeLogger(logger, nil).Info(parallel, "node")
+
+	entries := logs.AllUntimed()
+	assert.Equal(t, 2, len(entries))
+	for i, entry := range entries {
+		assert.Equal(t, file, entry.Caller.File)
+		assert.Equal(t, line+1+i, entry.Caller.Line)
+	}
+}
+
+func TestSlogLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := NewSlogLogger(slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug})), LogLevelWarn)
+	_, parallel := newLoggerTestContext()
+
+	logger.Info(parallel, "dropped")
+	logger.Error(parallel, "failed: %v", "boom")
+
+	record := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "ERROR", record["level"])
+	assert.Equal(t, "failed: boom", record["msg"])
+	assert.Equal(t, "Node", record["node"])
+	assert.Equal(t, "test/logger", record["module"])
+	assert.Equal(t, float64(3), record["parallel"])
+}
+
+func TestParseLogLevel(t *testing.T) {
+	level, err := ParseLogLevel("WARN")
+	assert.NoError(t, err)
+	assert.Equal(t, LogLevelWarn, level)
+	_, err = ParseLogLevel("verbose")
+	assert.Error(t, err)
+}
@@ -0,0 +1,35 @@
+package gpipe
+
+// Message 带有 header 的消息, 需要在节点之间传递元数据 (例如 kafka 的 key、来源等) 时使用
+// 引擎本身不关心消息的类型, 模块之间可以直接传递 *Message, 也可以继续传递任意值
+type Message struct {
+	Headers map[string]string
+	Payload interface{}
+}
+
+// NewMessage 创建没有 header 的消息
+func NewMessage(payload interface{}) *Message {
+	return &Message{Headers: map[string]string{}, Payload: payload}
+}
+
+// AsMessage 将任意消息转换为 *Message, 不是 *Message 的值作为 Payload, Headers 为空
+func AsMessage(v interface{}) *Message {
+	if msg, ok := v.(*Message); ok {
+		return msg
+	}
+	return NewMessage(v)
+}
+
+// Header 返回 key 对应的 header, 不存在时返回空串
+func (m *Message) Header(key string) string {
+	return m.Headers[key]
+}
+
+// WithPayload 返回 header 相同、payload 替换后的新消息, 原消息不会被修改
+func (m *Message) WithPayload(payload interface{}) *Message {
+	headers := make(map[string]string, len(m.Headers))
+	for k, v := range m.Headers {
+		headers[k] = v
+	}
+	return &Message{Headers: headers, Payload: payload}
+}
@@ -0,0 +1,20 @@
+package gpipe
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMessage(t *testing.T) {
+	msg := AsMessage("payload")
+	assert.Equal(t, &Message{Headers: map[string]string{}, Payload: "payload"}, msg)
+	assert.Equal(t, "", msg.Header("k"))
+
+	msg = &Message{Headers: map[string]string{"k": "v"}, Payload: 1}
+	assert.Same(t, msg, AsMessage(msg))
+	next := msg.WithPayload(2)
+	next.Headers["k"] = "changed"
+	assert.Equal(t, "v", msg.Header("k"))
+	assert.Equal(t, 1, msg.Payload)
+	assert.Equal(t, 2, next.Payload)
+}
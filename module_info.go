@@ -0,0 +1,154 @@
+package gpipe
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ModuleInfo ModuleFactory 可选实现的接口, 用于生成模块目录
+type ModuleInfo interface {
+	Info() ModuleMetadata
+}
+
+// ModuleMetadata 模块的描述信息, Input / Output 描述接收与发送的消息类型, 为空表示不接收或不发送
+type ModuleMetadata struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description,omitempty"`
+	Version     string            `json:"version,omitempty"`
+	Input       string            `json:"input,omitempty"`
+	Output      string            `json:"output,omitempty"`
+	Config      []ConfigFieldInfo `json:"config,omitempty"`
+	Aliases     []string          `json:"aliases,omitempty"`
+}
+
+// ConfigFieldInfo 模块配置中的一个字段
+type ConfigFieldInfo struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Default     string `json:"default,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// Catalogue 模块目录, 按模块名排列
+type Catalogue []ModuleMetadata
+
+// ConfigFieldsOf 根据配置结构体原型生成字段说明, 字段名取自 yaml tag, 说明与默认值取自 doc 与 default tag
+func ConfigFieldsOf(schema interface{}) []ConfigFieldInfo {
+	t := reflect.TypeOf(schema)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+	fields := []ConfigFieldInfo{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if !field.IsExported() || name == "-" {
+			continue
+		} else if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		fields = append(fields, ConfigFieldInfo{
+			Name:        name,
+			Type:        configTypeName(field.Type),
+			Default:     field.Tag.Get("default"),
+			Description: field.Tag.Get("doc"),
+		})
+	}
+	return fields
+}
+
+// configTypeName 基础类型的自定义类型 (例如 type serializer string) 显示为基础类型, 匿名结构体显示为 object
+func configTypeName(t reflect.Type) string {
+	switch {
+	case t.PkgPath() != "" && (t.Kind() <= reflect.Complex128 || t.Kind() == reflect.String):
+		return t.Kind().String()
+	case t.Name() != "":
+		return t.String()
+	case t.Kind() == reflect.Ptr:
+		return configTypeName(t.Elem())
+	case t.Kind() == reflect.Slice:
+		return "[]" + configTypeName(t.Elem())
+	case t.Kind() == reflect.Map:
+		return "map[" + configTypeName(t.Key()) + "]" + configTypeName(t.Elem())
+	case t.Kind() == reflect.Struct:
+		return "object"
+	}
+	return t.String()
+}
+
+// Modules 返回注册表中所有模块的目录, 没有实现 ModuleInfo 的模块只有名称
+func (r *Registry) Modules() Catalogue {
+	aliases := map[string][]string{}
+	for alias, name := range r.Aliases() {
+		aliases[name] = append(aliases[name], alias)
+	}
+	catalogue := Catalogue{}
+	for _, name := range r.List() {
+		mod, err := r.Get(name)
+		if err != nil {
+			continue
+		}
+		meta := ModuleMetadata{Name: name}
+		if info, ok := mod.(ModuleInfo); ok {
+			meta = info.Info()
+			meta.Name = name
+		}
+		if meta.Config == nil {
+			if withSchema, ok := mod.(ModuleConfigSchema); ok {
+				meta.Config = ConfigFieldsOf(withSchema.ConfigSchema())
+			}
+		}
+		meta.Aliases = aliases[name]
+		sort.Strings(meta.Aliases)
+		catalogue = append(catalogue, meta)
+	}
+	return catalogue
+}
+
+// ListModules 返回全局注册表中所有模块的目录
+func ListModules() Catalogue {
+	return moduleRegister.Modules()
+}
+
+func (c Catalogue) JSON() ([]byte, error) {
+	return json.MarshalIndent(c, "", "  ")
+}
+
+// Markdown 将目录渲染为 Markdown, 每个模块一节
+func (c Catalogue) Markdown() string {
+	sb := &strings.Builder{}
+	sb.WriteString("# Modules\n")
+	for _, meta := range c {
+		fmt.Fprintf(sb, "\n## %s\n\n", meta.Name)
+		if meta.Description != "" {
+			fmt.Fprintf(sb, "%s\n\n", meta.Description)
+		}
+		for _, item := range [][2]string{
+			{"version", meta.Version},
+			{"input", meta.Input},
+			{"output", meta.Output},
+			{"aliases", strings.Join(meta.Aliases, ", ")},
+		} {
+			if item[1] != "" {
+				fmt.Fprintf(sb, "- %s: `%s`\n", item[0], item[1])
+			}
+		}
+		if len(meta.Config) > 0 {
+			sb.WriteString("\n| field | type | default | description |\n|:--|:--|:--|:--|\n")
+			for _, field := range meta.Config {
+				fmt.Fprintf(sb, "| %s | `%s` | %s | %s |\n", field.Name, field.Type, markdownCell(field.Default), markdownCell(field.Description))
+			}
+		}
+	}
+	return sb.String()
+}
+
+func markdownCell(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+}
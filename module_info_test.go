@@ -0,0 +1,79 @@
+package gpipe
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type infoTestSerializer string
+
+type infoTestConfig struct {
+	Topic      string             `yaml:"topic" doc:"写入的 topic"`
+	Retries    int                `yaml:"retries" default:"3" doc:"重试次数 | 0 不重试"`
+	Serializer infoTestSerializer `yaml:"serializer"`
+	Jobs       []struct {
+		Tag string `yaml:"tag"`
+	} `yaml:"jobs"`
+	Extra  map[string]interface{} `yaml:",omitempty"`
+	hidden int
+}
+
+func TestRegistry_Modules(t *testing.T) {
+	registry := NewRegistry()
+	assert.NoError(t, registry.Register(NewSimpleModule("test/plain", nil)))
+	assert.NoError(t, registry.Register(NewSimpleModule("test/info", nil,
+		SimpleModuleWithConfigSchema(&infoTestConfig{}),
+		SimpleModuleWithInfo(ModuleMetadata{Description: "测试模块", Version: "1.2.0", Input: "any", Output: "[]byte"}),
+	)))
+	assert.NoError(t, registry.Alias("info", "test/info"))
+
+	catalogue := registry.Modules()
+	assert.Equal(t, Catalogue{
+		{
+			Name:        "test/info",
+			Description: "测试模块",
+			Version:     "1.2.0",
+			Input:       "any",
+			Output:      "[]byte",
+			Config: []ConfigFieldInfo{
+				{Name: "topic", Type: "string", Description: "写入的 topic"},
+				{Name: "retries", Type: "int", Default: "3", Description: "重试次数 | 0 不重试"},
+				{Name: "serializer", Type: "string"},
+				{Name: "jobs", Type: "[]object"},
+				{Name: "extra", Type: "map[string]interface {}"},
+			},
+			Aliases: []string{"info"},
+		},
+		{Name: "test/plain"},
+	}, catalogue)
+
+	assert.Equal(t, `# Modules
+
+## test/info
+
+测试模块
+
+- version: `+"`1.2.0`"+`
+- input: `+"`any`"+`
+- output: `+"`[]byte`"+`
+- aliases: `+"`info`"+`
+
+| field | type | default | description |
+|:--|:--|:--|:--|
+| topic | `+"`string`"+` |  | 写入的 topic |
+| retries | `+"`int`"+` | 3 | 重试次数 \| 0 不重试 |
+| serializer | `+"`string`"+` |  |  |
+| jobs | `+"`[]object`"+` |  |  |
+| extra | `+"`map[string]interface {}`"+` |  |  |
+
+## test/plain
+
+`, catalogue.Markdown())
+
+	data, err := catalogue.JSON()
+	assert.NoError(t, err)
+	decoded := Catalogue{}
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, catalogue, decoded)
+}
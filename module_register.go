@@ -1,20 +1,123 @@
 package gpipe
 
+import (
+	"sort"
+	"sync"
+)
+
+// Registry 模块注册表, 可并发使用. 每个 Engine 可以通过 EngineWithRegistry 使用独立的注册表
+type Registry struct {
+	lock      sync.RWMutex
+	modules   map[string]ModuleFactory
+	aliases   map[string]string          // 别名 -> 模块名
+	subgraphs map[string]*SubgraphConfig // 在代码中注册的子图
+}
+
 var (
-	moduleRegister = map[string]ModuleFactory{}
+	moduleRegister = NewRegistry()
 )
 
-func RegisterModule(m ModuleFactory) error {
-	if _, exists := moduleRegister[m.Name()]; exists {
+func NewRegistry() *Registry {
+	return &Registry{
+		modules:   map[string]ModuleFactory{},
+		aliases:   map[string]string{},
+		subgraphs: map[string]*SubgraphConfig{},
+	}
+}
+
+// DefaultRegistry 返回全局注册表, RegisterModule 注册的模块以及未指定注册表的 Engine 均使用它
+func DefaultRegistry() *Registry {
+	return moduleRegister
+}
+
+func (r *Registry) Register(m ModuleFactory) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, exists := r.modules[m.Name()]; exists {
 		return newGPWError("module %s already exists", m.Name())
+	} else if _, exists := r.aliases[m.Name()]; exists {
+		return newGPWError("module %s already exists as an alias", m.Name())
 	}
-	moduleRegister[m.Name()] = m
+	r.modules[m.Name()] = m
 	return nil
 }
 
-func GetModuleByName(name string) (ModuleFactory, error) {
-	if m, exists := moduleRegister[name]; exists {
+// Unregister 移除模块以及指向它的别名, 不影响已经运行的节点
+func (r *Registry) Unregister(name string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, exists := r.modules[name]; !exists {
+		return newGPWError("module %s not exists", name)
+	}
+	delete(r.modules, name)
+	for alias, target := range r.aliases {
+		if target == name {
+			delete(r.aliases, alias)
+		}
+	}
+	return nil
+}
+
+// Alias 为已注册的模块添加别名, 例如为 kafka/consumer 添加 kafka-consumer
+func (r *Registry) Alias(alias, name string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, exists := r.modules[name]; !exists {
+		return newGPWError("module %s not exists", name)
+	} else if _, exists := r.modules[alias]; exists {
+		return newGPWError("module %s already exists", alias)
+	} else if _, exists := r.aliases[alias]; exists {
+		return newGPWError("alias %s already exists", alias)
+	}
+	r.aliases[alias] = name
+	return nil
+}
+
+// Get 按模块名或别名查找模块
+func (r *Registry) Get(name string) (ModuleFactory, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	if target, ok := r.aliases[name]; ok {
+		name = target
+	}
+	if m, exists := r.modules[name]; exists {
 		return m, nil
 	}
 	return nil, newGPWError("module %s not exists", name)
 }
+
+// List 返回所有已注册的模块名 (不含别名), 按字母序排列
+func (r *Registry) List() []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	names := make([]string, 0, len(r.modules))
+	for name := range r.modules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Aliases 返回所有别名及其对应的模块名
+func (r *Registry) Aliases() map[string]string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	ret := make(map[string]string, len(r.aliases))
+	for alias, name := range r.aliases {
+		ret[alias] = name
+	}
+	return ret
+}
+
+func RegisterModule(m ModuleFactory) error {
+	return moduleRegister.Register(m)
+}
+
+func GetModuleByName(name string) (ModuleFactory, error) {
+	return moduleRegister.Get(name)
+}
+
+// ListModuleNames 返回全局注册表中所有的模块名, 按字母序排列
+func ListModuleNames() []string {
+	return moduleRegister.List()
+}
@@ -0,0 +1,89 @@
+package gpipe
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+	mod := NewSimpleModule("test/mod", nil)
+	assert.NoError(t, registry.Register(mod))
+	assert.Error(t, registry.Register(mod))
+	assert.NoError(t, registry.Alias("mod", "test/mod"))
+	assert.Error(t, registry.Alias("mod", "test/mod"))
+	assert.Error(t, registry.Alias("other", "test/missing"))
+	assert.Error(t, registry.Register(NewSimpleModule("mod", nil)))
+
+	got, err := registry.Get("mod")
+	assert.NoError(t, err)
+	assert.Equal(t, mod, got)
+	assert.Equal(t, []string{"test/mod"}, registry.List())
+	assert.Equal(t, map[string]string{"mod": "test/mod"}, registry.Aliases())
+
+	assert.NoError(t, registry.Unregister("test/mod"))
+	assert.Error(t, registry.Unregister("test/mod"))
+	_, err = registry.Get("mod")
+	assert.Error(t, err)
+	assert.Empty(t, registry.Aliases())
+
+	// 并发注册
+	wg := sync.WaitGroup{}
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.NoError(t, registry.Register(NewSimpleModule(string(rune('a'+i)), nil)))
+			registry.List()
+		}(i)
+	}
+	wg.Wait()
+	assert.Len(t, registry.List(), 16)
+}
+
+func TestEngine_WithRegistry(t *testing.T) {
+	// 两个 Engine 在各自的注册表中使用同名的模块
+	newEngine := func(value string) (*Engine, chan interface{}) {
+		recv := make(chan interface{}, 1)
+		registry := NewRegistry()
+		assert.NoError(t, registry.Register(NewSimpleModule("gen", func(name string, config interface{}) (ModuleInstance, error) {
+			return NewSimpleModuleInstance("gen", name, func(ctx context.Context, modCtx ModuleContext) error {
+				modCtx.Collect(value)
+				return nil
+			}), nil
+		})))
+		assert.NoError(t, registry.Register(NewSimpleModule("sink", func(name string, config interface{}) (ModuleInstance, error) {
+			return NewSimpleModuleInstance("sink", name, func(ctx context.Context, modCtx ModuleContext) error {
+				recv <- <-modCtx.MessageQueue()
+				return nil
+			}), nil
+		})))
+		assert.NoError(t, registry.Alias("source", "gen"))
+		return NewEngine(EngineWithRegistry(registry)), recv
+	}
+	cfg := `
+engine:
+  Gen:
+    module: source
+    parent: [ ]
+  Sink:
+    module: sink
+    parent: [ Gen ]
+`
+	eng1, recv1 := newEngine("one")
+	eng2, recv2 := newEngine("two")
+	assert.NoError(t, eng1.Run(context.Background(), strings.NewReader(cfg)))
+	defer eng1.Stop()
+	assert.NoError(t, eng2.Run(context.Background(), strings.NewReader(cfg)))
+	defer eng2.Stop()
+	assert.Equal(t, "one", <-recv1)
+	assert.Equal(t, "two", <-recv2)
+
+	// 全局注册表中不存在这些模块
+	_, err := NewEngine().LoadConfig(strings.NewReader(cfg))
+	assert.NoError(t, err)
+	assert.Error(t, NewEngine().Run(context.Background(), strings.NewReader(cfg)))
+}
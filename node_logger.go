@@ -0,0 +1,139 @@
+package gpipe
+
+import (
+	"gopkg.in/yaml.v3"
+	"sync"
+	"time"
+)
+
+// NodeLogConfig 节点级别的日志配置, 作用于 ModuleContext.Logger() 返回的 Logger
+type NodeLogConfig struct {
+	Level      LogLevel `yaml:"level"`      // 低于该级别的日志被丢弃
+	SampleRate float64  `yaml:"sampleRate"` // 每秒允许输出的日志条数, <= 0 表示不采样; Error 日志不参与采样
+	Burst      int      `yaml:"burst"`      // 允许的突发条数, 最小为 1
+}
+
+func (l LogLevel) MarshalYAML() (interface{}, error) {
+	return l.String(), nil
+}
+
+func (l *LogLevel) UnmarshalYAML(value *yaml.Node) error {
+	level, err := ParseLogLevel(value.Value)
+	if err != nil {
+		return err
+	}
+	*l = level
+	return nil
+}
+
+// nodeLogger 按节点配置对日志做级别过滤与令牌桶采样后转发给引擎的 Logger
+type nodeLogger struct {
+	next Logger
+	now  func() time.Time
+
+	lock   sync.Mutex
+	cfg    NodeLogConfig
+	tokens float64
+	last   time.Time
+}
+
+func newNodeLogger(next Logger, cfg *NodeLogConfig) *nodeLogger {
+	if skipper, ok := next.(callerSkipper); ok {
+		next = skipper.withCallerSkip(1)
+	}
+	l := &nodeLogger{next: next, now: time.Now}
+	if cfg != nil {
+		l.setConfig(*cfg)
+	}
+	return l
+}
+
+func (l *nodeLogger) setConfig(cfg NodeLogConfig) {
+	if cfg.Burst < 1 {
+		cfg.Burst = 1
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.cfg = cfg
+	l.tokens = float64(cfg.Burst)
+	l.last = l.now()
+}
+
+func (l *nodeLogger) config() NodeLogConfig {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.cfg
+}
+
+func (l *nodeLogger) allow(level LogLevel) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if level < l.cfg.Level {
+		return false
+	}
+	if l.cfg.SampleRate <= 0 || level >= LogLevelError {
+		return true
+	}
+	now := l.now()
+	l.tokens += now.Sub(l.last).Seconds() * l.cfg.SampleRate
+	l.last = now
+	if l.tokens > float64(l.cfg.Burst) {
+		l.tokens = float64(l.cfg.Burst)
+	}
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+func (l *nodeLogger) ModuleStarted(ctx ModuleContext) {
+	l.next.ModuleStarted(ctx)
+}
+
+func (l *nodeLogger) ModuleStopped(ctx ModuleContext) {
+	l.next.ModuleStopped(ctx)
+}
+
+func (l *nodeLogger) Info(ctx ModuleContext, s string, i ...interface{}) {
+	if l.allow(LogLevelInfo) {
+		l.next.Info(ctx, s, i...)
+	}
+}
+
+func (l *nodeLogger) Warn(ctx ModuleContext, s string, i ...interface{}) {
+	if l.allow(LogLevelWarn) {
+		l.next.Warn(ctx, s, i...)
+	}
+}
+
+func (l *nodeLogger) Error(ctx ModuleContext, s string, i ...interface{}) {
+	if l.allow(LogLevelError) {
+		l.next.Error(ctx, s, i...)
+	}
+}
+
+func (l *nodeLogger) Trace(ctx ModuleContext, s string, i ...interface{}) {
+	if l.allow(LogLevelTrace) {
+		l.next.Trace(ctx, s, i...)
+	}
+}
+
+// SetNodeLogConfig 在运行时调整节点的日志级别与采样配置
+func (e *Engine) SetNodeLogConfig(name string, cfg NodeLogConfig) error {
+	node, err := e.getNode(name)
+	if err != nil {
+		return err
+	}
+	node.logger.setConfig(cfg)
+	return nil
+}
+
+// NodeLogConfig 获取节点当前的日志配置
+func (e *Engine) NodeLogConfig(name string) (NodeLogConfig, error) {
+	node, err := e.getNode(name)
+	if err != nil {
+		return NodeLogConfig{}, err
+	}
+	return node.logger.config(), nil
+}
@@ -0,0 +1,98 @@
+package gpipe
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// messageLogger 记录所有日志内容的 Logger
+type messageLogger struct {
+	recordLogger
+	messages []string
+}
+
+func (l *messageLogger) record(level string, s string, i ...interface{}) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.messages = append(l.messages, level+" "+fmt.Sprintf(s, i...))
+}
+
+func (l *messageLogger) Info(_ ModuleContext, s string, i ...interface{})  { l.record("info", s, i...) }
+func (l *messageLogger) Warn(_ ModuleContext, s string, i ...interface{})  { l.record("warn", s, i...) }
+func (l *messageLogger) Error(_ ModuleContext, s string, i ...interface{}) { l.record("error", s, i...) }
+func (l *messageLogger) Trace(_ ModuleContext, s string, i ...interface{}) { l.record("trace", s, i...) }
+
+func (l *messageLogger) all() []string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return append([]string{}, l.messages...)
+}
+
+func TestNodeLogger_Sampling(t *testing.T) {
+	next := &messageLogger{}
+	now := time.Unix(0, 0)
+	logger := &nodeLogger{next: next, now: func() time.Time { return now }}
+	logger.setConfig(NodeLogConfig{Level: LogLevelInfo, SampleRate: 2, Burst: 3})
+
+	for i := 0; i < 5; i++ {
+		logger.Info(nil, "info %d", i)
+	}
+	logger.Trace(nil, "trace")
+	logger.Error(nil, "error")
+	// 0.5s 补充 1 个令牌
+	now = now.Add(time.Millisecond * 500)
+	logger.Warn(nil, "warn")
+	logger.Warn(nil, "dropped")
+
+	assert.Equal(t, []string{"info info 0", "info info 1", "info info 2", "error error", "warn warn"}, next.all())
+}
+
+func TestEngine_NodeLogConfig(t *testing.T) {
+	modName := uuid.NewString()
+	var (
+		wg     sync.WaitGroup
+		modCtx ModuleContext
+	)
+	wg.Add(1)
+	assert.NoError(t, RegisterModule(NewSimpleModule(modName, func(name string, config interface{}) (ModuleInstance, error) {
+		return NewSimpleModuleInstance(modName, name, func(ctx context.Context, c ModuleContext) error {
+			modCtx = c
+			wg.Done()
+			<-ctx.Done()
+			return nil
+		}), nil
+	})))
+	logger := &messageLogger{}
+	eng := NewEngine(EngineWithLogger(logger))
+	assert.NoError(t, eng.Run(context.Background(), strings.NewReader(fmt.Sprintf(`
+engine:
+  Hot:
+    module: %s
+    parent: [ ]
+    queueSize: 1
+    parallels: 1
+    log:
+      level: warn
+`, modName))))
+	defer eng.Stop()
+	wg.Wait()
+	// 引擎自身的日志不受节点配置影响, 只检查之后由模块输出的日志
+	before := len(logger.all())
+
+	modCtx.Logger().Trace(modCtx, "hidden")
+	modCtx.Logger().Warn(modCtx, "visible")
+	assert.NoError(t, eng.SetNodeLogConfig("Hot", NodeLogConfig{Level: LogLevelTrace}))
+	modCtx.Logger().Trace(modCtx, "now visible")
+
+	cfg, err := eng.NodeLogConfig("Hot")
+	assert.NoError(t, err)
+	assert.Equal(t, LogLevelTrace, cfg.Level)
+	assert.Equal(t, []string{"warn visible", "trace now visible"}, logger.all()[before:])
+	assert.Error(t, eng.SetNodeLogConfig("Unknown", NodeLogConfig{}))
+}
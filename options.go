@@ -1,6 +1,9 @@
 package gpipe
 
-import "time"
+import (
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
 
 type EngineOptions func(engine *Engine)
 
@@ -10,8 +13,78 @@ func EngineWithLogger(logger Logger) EngineOptions {
 	}
 }
 
+// EngineWithLogLevel 设置默认 logger 的日志级别, 使用 EngineWithLogger 时无效
+func EngineWithLogLevel(level LogLevel) EngineOptions {
+	return func(engine *Engine) {
+		engine.logLevel = level
+	}
+}
+
 func EngineWithSlowThresholdMs(thresholdMs time.Duration) EngineOptions {
 	return func(engine *Engine) {
 		engine.slowThreshold = thresholdMs
 	}
 }
+
+// EngineWithTracerProvider 开启 OpenTelemetry tracing, 每条消息在经过的每个节点上都会产生一个 span
+func EngineWithTracerProvider(tp trace.TracerProvider) EngineOptions {
+	return func(engine *Engine) {
+		engine.tracer = tp.Tracer(tracerName)
+	}
+}
+
+// EngineWithSecretResolver 注册 ${scheme:ref} 形式引用的解析器, 可覆盖内置的 file / env
+func EngineWithSecretResolver(scheme string, resolver SecretResolver) EngineOptions {
+	return func(engine *Engine) {
+		engine.secretResolvers[scheme] = resolver
+	}
+}
+
+// EngineWithRegistry 使用独立的模块注册表, 默认使用全局注册表
+func EngineWithRegistry(registry *Registry) EngineOptions {
+	return func(engine *Engine) {
+		engine.registry = registry
+	}
+}
+
+// EngineWithFlushTimeout 设置节点停止时调用 Flusher.Flush 的超时时间, 默认 10s
+func EngineWithFlushTimeout(timeout time.Duration) EngineOptions {
+	return func(engine *Engine) {
+		engine.flushTimeout = timeout
+	}
+}
+
+// EngineWithConfigDir 设置配置中 include 相对路径的基准目录
+func EngineWithConfigDir(dir string) EngineOptions {
+	return func(engine *Engine) {
+		engine.configDir = dir
+	}
+}
+
+// EngineWithNodeDefaults 设置节点未配置 queueSize / parallels 时的默认值, 模块自身提供的默认值优先
+func EngineWithNodeDefaults(defaults NodeDefaults) EngineOptions {
+	return func(engine *Engine) {
+		engine.nodeDefaults = defaults
+	}
+}
+
+// EngineWithConfigFormat 指定配置的格式, 默认根据文件扩展名或内容判断
+func EngineWithConfigFormat(format ConfigFormat) EngineOptions {
+	return func(engine *Engine) {
+		engine.configFormat = format
+	}
+}
+
+// EngineWithPluginDir 启动时从 dir 加载所有 .so 插件, 并将其中的模块注册到 Engine 使用的注册表
+func EngineWithPluginDir(dir string) EngineOptions {
+	return func(engine *Engine) {
+		engine.pluginDir = dir
+	}
+}
+
+// EngineWithClock 设置 QPS 统计以及模块通过 ModuleContext.Clock 使用的时钟, 默认为系统时钟
+func EngineWithClock(clock Clock) EngineOptions {
+	return func(engine *Engine) {
+		engine.clock = clock
+	}
+}
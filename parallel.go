@@ -0,0 +1,230 @@
+package gpipe
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// envelope 节点间队列中实际传递的结构, 携带入队时间等元信息
+type envelope struct {
+	value      interface{}
+	enqueuedAt time.Time
+	spanCtx    trace.SpanContext // 上游节点的 span, 未开启 tracing 时为空
+	state      atomic.Int32      // envWaiting / envSlot / envTaken, 占用的队列位置被 Core 取走后释放
+	taken      chan struct{}     // 入队时队列已满则创建, 未占用位置时被 Core 取走后关闭
+}
+
+// parallelContext 每个 parallel 独立持有的 ModuleContext
+// 由 pump 从节点共享的队列中取出 envelope, 通过无缓冲的 output 交给 Core, 以此观测出队时刻
+// pump 手中的消息仍然计入节点队列, 被 Core 取走前若 parallel 停止或节点暂停, 消息会放回队列
+// 未开启 tracing 时 Collect 不与 pump 同步: Core 取走消息后可能先于 pump 记录出队时刻调用 Collect,
+// 此时该消息的 time-in-node 在下一次 Collect 或下一条消息被取走时记录, 避免每条消息额外两次 goroutine 切换
+type parallelContext struct {
+	*moduleContext
+	index   int
+	cancel  context.CancelFunc // 停止该 parallel
+	output  chan interface{}
+	barrier chan struct{} // 开启 tracing 时 Collect 等与 pump 同步, 保证使用的是 Core 当前处理的消息的 span
+	done    chan struct{} // pump 退出后关闭
+
+	mu         sync.Mutex
+	dequeuedAt time.Time  // 当前消息被 Core 取走的时间
+	pending    bool       // 当前消息还未计入 time-in-node
+	span       trace.Span // 当前消息在该节点的 span, 未开启 tracing 时为 nil
+}
+
+func newParallelContext(node *moduleContext, index int, cancel context.CancelFunc) *parallelContext {
+	return &parallelContext{
+		moduleContext: node,
+		index:         index,
+		cancel:        cancel,
+		output:        make(chan interface{}),
+		barrier:       make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+}
+
+// pump 将节点队列的消息逐条交给该 parallel, 直到 ctx 结束
+// 暂停时不再取出消息; 已取出但未被 Core 取走的消息在暂停或 ctx 结束时放回队列
+func (p *parallelContext) pump(ctx context.Context) {
+	defer close(p.done)
+	defer p.ack()
+	for {
+		if !p.pumpResume(ctx) {
+			return
+		}
+		env, ok := p.receive(ctx)
+		if !ok {
+			return
+		}
+		if !p.offer(ctx, env) {
+			p.requeue(env)
+		}
+	}
+}
+
+// pumpResume 节点暂停时阻塞直到恢复, ctx 结束时返回 false
+func (p *parallelContext) pumpResume(ctx context.Context) bool {
+	for {
+		p.ctrlLock.Lock()
+		resumeCh := p.resumeCh
+		p.ctrlLock.Unlock()
+		if resumeCh == nil {
+			return true
+		}
+		select {
+		case _ = <-resumeCh:
+			return true
+		case _ = <-ctx.Done():
+			return false
+		case _ = <-p.barrier:
+		}
+	}
+}
+
+// receive 取出下一条消息, 优先取放回队列的消息
+func (p *parallelContext) receive(ctx context.Context) (*envelope, bool) {
+	for ctx.Err() == nil {
+		env, requeueCh := p.popRequeued()
+		if env != nil {
+			return env, true
+		}
+		select {
+		case _ = <-ctx.Done():
+			return nil, false
+		case env = <-p.input:
+			return env, true
+		case _ = <-requeueCh:
+		case _ = <-p.barrier:
+		}
+	}
+	return nil, false
+}
+
+// offer 将消息交给 Core, 节点暂停或 ctx 结束时放弃并返回 false
+func (p *parallelContext) offer(ctx context.Context, env *envelope) bool {
+	paused := p.pauseSignal()
+	for {
+		select {
+		case _ = <-ctx.Done():
+			return false
+		case _ = <-paused:
+			return false
+		default:
+		}
+		select {
+		case _ = <-ctx.Done():
+			return false
+		case _ = <-paused:
+			return false
+		case _ = <-p.barrier:
+		case p.output <- env.value:
+			p.delivered(env)
+			return true
+		}
+	}
+}
+
+// sync 等待 pump 处理完 Core 已取走的消息, 之后读取的是 Core 当前处理的消息的状态
+// 只有 span 需要准确对应到消息, 未开启 tracing 时直接返回
+func (p *parallelContext) sync() {
+	if p.engine.tracer == nil {
+		return
+	}
+	select {
+	case p.barrier <- struct{}{}:
+	case _ = <-p.done:
+	}
+}
+
+// delivered Core 已取走 env, 上一条消息若还未 Collect 过则视为在此刻 ack
+func (p *parallelContext) delivered(env *envelope) {
+	now := time.Now()
+	p.release(env)
+	p.queueLatency.Record(now.Sub(env.enqueuedAt))
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ackLocked(now)
+	p.dequeuedAt = now
+	p.pending = true
+	if p.engine.tracer != nil {
+		_, p.span = p.engine.tracer.Start(
+			trace.ContextWithRemoteSpanContext(context.Background(), env.spanCtx),
+			p.name,
+			trace.WithTimestamp(now),
+			trace.WithAttributes(attribute.Int("gpipe.parallel", p.index)),
+		)
+	}
+}
+
+// ack 当前消息首次 Collect 时记录 time-in-node 并结束其 span
+func (p *parallelContext) ack() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ackLocked(time.Now())
+}
+
+func (p *parallelContext) ackLocked(now time.Time) {
+	if !p.pending {
+		return
+	}
+	p.nodeLatency.Record(now.Sub(p.dequeuedAt))
+	if p.span != nil {
+		p.span.End(trace.WithTimestamp(now))
+	}
+	p.pending = false
+}
+
+func (p *parallelContext) ParallelIndex() int {
+	return p.index
+}
+
+func (p *parallelContext) MessageQueue() chan interface{} {
+	return p.output
+}
+
+// Context 携带当前消息 span 的 ctx, span 结束后仍可作为后续 Collect 的上级 span
+func (p *parallelContext) Context() context.Context {
+	p.sync()
+	return p.spanContext()
+}
+
+func (p *parallelContext) spanContext() context.Context {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.span == nil {
+		return p.ctx
+	}
+	return trace.ContextWithSpan(p.ctx, p.span)
+}
+
+func (p *parallelContext) Collect(v interface{}) {
+	p.sync()
+	p.collect(p.spanContext(), v)
+}
+
+func (p *parallelContext) CollectWithContext(ctx context.Context, v interface{}) {
+	p.sync()
+	p.collect(ctx, v)
+}
+
+func (p *parallelContext) collect(ctx context.Context, v interface{}) {
+	p.ack()
+	if p.engine.tracer != nil && !p.isInputSpan(trace.SpanContextFromContext(ctx)) {
+		// 不是由输入消息触发的 Collect (例如 source 节点), 为每条消息单独创建一个 span
+		var span trace.Span
+		ctx, span = p.engine.tracer.Start(ctx, p.name, trace.WithAttributes(attribute.Int("gpipe.parallel", p.index)))
+		defer span.End()
+	}
+	p.moduleContext.CollectWithContext(ctx, v)
+}
+
+func (p *parallelContext) isInputSpan(spanCtx trace.SpanContext) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.span != nil && spanCtx.IsValid() && p.span.SpanContext().Equal(spanCtx)
+}
@@ -0,0 +1,166 @@
+package gpipe
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// sourceInstance 依次 Collect values, 记录已返回的 Collect 次数
+type sourceInstance struct {
+	values []interface{}
+	sent   atomic.Int32
+}
+
+func (s *sourceInstance) Core(ctx context.Context, modCtx ModuleContext) error {
+	for _, v := range s.values {
+		modCtx.Collect(v)
+		s.sent.Add(1)
+	}
+	<-ctx.Done()
+	return nil
+}
+
+func runPipeline(t *testing.T, source ModuleInstance, sink ModuleInstance, opts ...NodeOption) *Engine {
+	cfg, err := NewPipeline().Source("Source", source, nil).Then("Sink", sink, nil, opts...).Build()
+	assert.NoError(t, err)
+	eng := NewEngine(EngineWithLogLevel(LogLevelError))
+	assert.NoError(t, eng.RunConfig(context.Background(), cfg))
+	t.Cleanup(eng.Stop)
+	return eng
+}
+
+func receive(t *testing.T, recv <-chan interface{}) interface{} {
+	t.Helper()
+	select {
+	case v := <-recv:
+		return v
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+		return nil
+	}
+}
+
+func TestParallel_StopKeepsQueuedMessages(t *testing.T) {
+	recv := make(chan interface{}, 10)
+	runs := atomic.Int32{}
+	sink := NewSimpleModuleInstance("sink", "Sink", func(ctx context.Context, modCtx ModuleContext) error {
+		// 第一次运行只处理一条消息, 其余消息留在队列中
+		first := runs.Add(1) == 1
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case v := <-modCtx.MessageQueue():
+				recv <- v
+				if first {
+					<-ctx.Done()
+					return nil
+				}
+			}
+		}
+	})
+	source := &sourceInstance{values: []interface{}{1, 2, 3, 4}}
+	eng := runPipeline(t, source, sink, NodeWithQueueSize(2))
+	assert.Equal(t, 1, receive(t, recv))
+	// 一条消息被 Core 取走, 两条在队列中, 最后一条的 Collect 阻塞
+	assert.Eventually(t, func() bool { return source.sent.Load() == 3 }, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, int32(3), source.sent.Load())
+	assert.Equal(t, 2, eng.Stats()[1].QueueSize)
+
+	assert.NoError(t, eng.StopNode("Sink"))
+	assert.NoError(t, eng.ScaleNode("Sink", 1))
+	for _, expect := range []int{2, 3, 4} {
+		assert.Equal(t, expect, receive(t, recv))
+	}
+}
+
+func TestParallel_PauseKeepsQueuedMessages(t *testing.T) {
+	recv := make(chan interface{}, 10)
+	sink := NewSimpleModuleInstance("sink", "Sink", func(ctx context.Context, modCtx ModuleContext) error {
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case v := <-modCtx.MessageQueue():
+				recv <- v
+			}
+		}
+	})
+	eng := runPipeline(t, &sourceInstance{}, sink, NodeWithQueueSize(2))
+	assert.NoError(t, eng.PauseNode("Sink"))
+	node, err := eng.getNode("Source")
+	assert.NoError(t, err)
+	node.Collect(1)
+	node.Collect(2)
+	time.Sleep(20 * time.Millisecond)
+	assert.Empty(t, recv)
+	assert.Equal(t, 2, eng.Stats()[1].QueueSize)
+
+	assert.NoError(t, eng.ResumeNode("Sink"))
+	assert.Equal(t, 1, receive(t, recv))
+	assert.Equal(t, 2, receive(t, recv))
+}
+
+func TestParallel_NodeMessageQueue(t *testing.T) {
+	sink := NewSimpleModuleInstance("sink", "Sink", func(ctx context.Context, modCtx ModuleContext) error {
+		<-ctx.Done()
+		return nil
+	})
+	source := &sourceInstance{}
+	eng := runPipeline(t, source, sink, NodeWithQueueSize(1))
+	// 停止 parallel 后节点本身仍在运行, 消息只会由节点级别的 pump 取出
+	assert.NoError(t, eng.StopNode("Sink"))
+	node, err := eng.getNode("Sink")
+	assert.NoError(t, err)
+	from, err := eng.getNode("Source")
+	assert.NoError(t, err)
+	go func() {
+		for _, v := range []int{1, 2, 3} {
+			from.Collect(v)
+		}
+	}()
+	assert.Equal(t, -1, node.ParallelIndex())
+	queue := node.MessageQueue()
+	assert.Equal(t, queue, node.MessageQueue())
+	for _, expect := range []int{1, 2, 3} {
+		assert.Equal(t, expect, receive(t, queue))
+	}
+}
+
+// BenchmarkParallel_Collect 每条消息经过 pump 交给 Core, Core 收到后 Collect, 覆盖延迟统计的开销
+func BenchmarkParallel_Collect(b *testing.B) {
+	finished := make(chan struct{})
+	forward := NewSimpleModuleInstance("forward", "Forward", func(ctx context.Context, modCtx ModuleContext) error {
+		for i := 0; i < b.N; i++ {
+			modCtx.Collect(<-modCtx.MessageQueue())
+		}
+		close(finished)
+		<-ctx.Done()
+		return nil
+	})
+	cfg, err := NewPipeline().
+		Source("Source", &sourceInstance{}, nil).
+		Then("Forward", forward, nil, NodeWithQueueSize(64)).
+		Build()
+	if err != nil {
+		b.Fatal(err)
+	}
+	eng := NewEngine(EngineWithLogLevel(LogLevelError))
+	if err := eng.RunConfig(context.Background(), cfg); err != nil {
+		b.Fatal(err)
+	}
+	defer eng.Stop()
+	source, err := eng.getNode("Source")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		source.Collect(i)
+	}
+	<-finished
+}
@@ -0,0 +1,148 @@
+package gpipe
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// Pipeline 以代码的方式构造 Config, 例如
+//
+//	gpipe.NewPipeline().
+//		Source("gen", "randomGen", nil).
+//		Then("double", doubleFactory, nil, gpipe.NodeWithParallels(4)).
+//		From("gen").Then("treble", trebleInstance, nil).
+//		FanIn("print", []string{"double", "treble"}, "print", nil).
+//		Build()
+type Pipeline struct {
+	cfg    *Config
+	cursor []string // Then 使用的上级节点
+	errs   []error
+}
+
+type NodeOption func(cfg *WorkNodeConfig)
+
+func NodeWithQueueSize(size int) NodeOption {
+	return func(cfg *WorkNodeConfig) {
+		cfg.QueueSize = size
+		cfg.queueSizeSet = true
+	}
+}
+
+func NodeWithParallels(parallels int) NodeOption {
+	return func(cfg *WorkNodeConfig) {
+		cfg.Parallels = parallels
+		cfg.parallelsSet = true
+	}
+}
+
+func NodeWithLog(log NodeLogConfig) NodeOption {
+	return func(cfg *WorkNodeConfig) {
+		cfg.Log = &log
+	}
+}
+
+func NewPipeline() *Pipeline {
+	return &Pipeline{cfg: &Config{Engine: map[string]*WorkNodeConfig{}}}
+}
+
+// Source 添加一个根节点
+// module 可以是已注册的模块名 (string)、ModuleFactory 或已经构造好的 ModuleInstance, ModuleInstance 只能运行一次
+func (p *Pipeline) Source(name string, module interface{}, config interface{}, opts ...NodeOption) *Pipeline {
+	return p.add(name, []string{}, module, config, opts)
+}
+
+// Then 添加一个以上一个节点 (或 From 指定的节点) 为上级的节点
+func (p *Pipeline) Then(name string, module interface{}, config interface{}, opts ...NodeOption) *Pipeline {
+	if len(p.cursor) == 0 {
+		p.errs = append(p.errs, newGPWError("worker %s: Then without a previous node", name))
+		return p
+	}
+	return p.add(name, p.cursor, module, config, opts)
+}
+
+// FanIn 添加一个以 parents 为上级的节点, 所有上级的输出汇聚到该节点
+func (p *Pipeline) FanIn(name string, parents []string, module interface{}, config interface{}, opts ...NodeOption) *Pipeline {
+	return p.add(name, parents, module, config, opts)
+}
+
+// From 将后续 Then 的上级设置为 names, 用于从已有节点分出新的分支
+func (p *Pipeline) From(names ...string) *Pipeline {
+	p.cursor = append([]string{}, names...)
+	return p
+}
+
+func (p *Pipeline) add(name string, parents []string, module interface{}, config interface{}, opts []NodeOption) *Pipeline {
+	if _, exists := p.cfg.Engine[name]; exists {
+		p.errs = append(p.errs, newGPWError("duplicate worker name: %s", name))
+		return p
+	}
+	nodeCfg := &WorkNodeConfig{
+		Parent: append([]string{}, parents...),
+		Config: config,
+	}
+	switch mod := module.(type) {
+	case string:
+		nodeCfg.Module = mod
+	case ModuleFactory:
+		nodeCfg.Module = mod.Name()
+		nodeCfg.factory = mod
+	case ModuleInstance:
+		nodeCfg.factory = &instanceFactory{name: instanceModuleName(mod), node: name, inst: mod}
+		nodeCfg.Module = nodeCfg.factory.Name()
+	default:
+		p.errs = append(p.errs, newGPWError("worker %s: invalid module type %T", name, module))
+		return p
+	}
+	for _, opt := range opts {
+		opt(nodeCfg)
+	}
+	p.cfg.Engine[name] = nodeCfg
+	p.cursor = []string{name}
+	return p
+}
+
+// Build 返回构造好的 Config, 检查节点名、上级节点、环、显式设置的 queueSize / parallels 以及直接传入的模块的配置
+// 按名称引用的模块、子图与默认值取决于运行时 Engine 的注册表与设置, 由 Engine.RunConfig 展开并完整校验
+func (p *Pipeline) Build() (*Config, error) {
+	if len(p.errs) > 0 {
+		return nil, errors.Join(p.errs...)
+	}
+	checked := p.cfg.clone()
+	// 空的注册表: 只检查直接传入的模块, 未设置的 queueSize / parallels 由 RunConfig 按 Engine 的默认值填充
+	checked.registry = NewRegistry()
+	checked.applyDefaults(NodeDefaults{QueueSize: 0, Parallels: 1})
+	if err := checked.Valid(); err != nil {
+		return nil, err
+	}
+	return p.cfg.clone(), nil
+}
+
+// instanceFactory 将已经构造好的 ModuleInstance 包装为 ModuleFactory
+// 实例只能使用一次: Engine 停止后会调用其 Close, 再次运行需要传入 ModuleFactory 以构造新的实例
+type instanceFactory struct {
+	name string
+	node string
+	inst ModuleInstance
+	used atomic.Bool
+}
+
+// instanceModuleName 直接传入的实例所使用的模块名
+func instanceModuleName(inst ModuleInstance) string {
+	if named, ok := inst.(interface{ moduleName() string }); ok {
+		return named.moduleName()
+	}
+	return strings.TrimPrefix(fmt.Sprintf("%T", inst), "*")
+}
+
+func (f *instanceFactory) Name() string {
+	return f.name
+}
+
+func (f *instanceFactory) New(name string, config interface{}) (ModuleInstance, error) {
+	if !f.used.CompareAndSwap(false, true) {
+		return nil, newGPWError("instance of worker %s has already been used, pass a ModuleFactory to run it again", f.node)
+	}
+	return f.inst, nil
+}
@@ -0,0 +1,109 @@
+package gpipe
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPipeline(t *testing.T) {
+	genName := uuid.NewString()
+	const total = 10
+	recv := make(chan int, 2*total)
+	assert.NoError(t, RegisterModule(NewSimpleModule(genName, func(name string, config interface{}) (ModuleInstance, error) {
+		return NewSimpleModuleInstance(genName, name, func(ctx context.Context, modCtx ModuleContext) error {
+			for i := 0; i < config.(int); i++ {
+				modCtx.Collect(i)
+			}
+			return nil
+		}), nil
+	})))
+	multiply := func(name string, config interface{}) (ModuleInstance, error) {
+		return NewSimpleModuleInstance(name, name, func(ctx context.Context, modCtx ModuleContext) error {
+			for {
+				select {
+				case <-ctx.Done():
+					return nil
+				case v := <-modCtx.MessageQueue():
+					modCtx.Collect(v.(int) * config.(int))
+				}
+			}
+		}), nil
+	}
+	treble, _ := multiply("treble", 3)
+	sink := NewSimpleModuleInstance("sink", "sink", func(ctx context.Context, modCtx ModuleContext) error {
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case v := <-modCtx.MessageQueue():
+				recv <- v.(int)
+			}
+		}
+	})
+
+	cfg, err := NewPipeline().
+		Source("Gen", genName, total).
+		Then("Double", NewSimpleModule(uuid.NewString(), multiply), 2, NodeWithQueueSize(4), NodeWithParallels(2)).
+		From("Gen").Then("Treble", treble, nil).
+		FanIn("Sink", []string{"Double", "Treble"}, sink, nil, NodeWithQueueSize(2)).
+		Build()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Double", "Treble"}, cfg.Engine["Sink"].Parent)
+	assert.Equal(t, 2, cfg.Engine["Double"].Parallels)
+	assert.Equal(t, "treble", cfg.Engine["Treble"].Module)
+
+	eng := NewEngine()
+	assert.NoError(t, eng.RunConfig(context.Background(), cfg))
+	defer eng.Stop()
+	sum := 0
+	for i := 0; i < 2*total; i++ {
+		sum += <-recv
+	}
+	assert.Equal(t, 5*total*(total-1)/2, sum)
+}
+
+func TestPipeline_Error(t *testing.T) {
+	for _, c := range []struct {
+		pipeline *Pipeline
+		msg      string
+	}{
+		{NewPipeline().Source("A", "interval", nil).Source("A", "interval", nil), "duplicate worker name: A"},
+		{NewPipeline().Then("A", "interval", nil), "worker A: Then without a previous node"},
+		{NewPipeline().Source("A", 42, nil), "worker A: invalid module type int"},
+		{NewPipeline().Source("A", "interval", nil).FanIn("B", []string{"A", "C"}, "interval", nil), "worker B has invalid parent C"},
+		{NewPipeline().Source("A", "interval", nil, NodeWithParallels(0)), "worker A has invalid parallels 0"},
+		{NewPipeline().Source("A", "interval", nil).FanIn("B", []string{"A", "C"}, "interval", nil).Then("C", "interval", nil), "has cycle among B, C"},
+	} {
+		_, err := c.pipeline.Build()
+		if assert.Error(t, err, c.msg) {
+			assert.Contains(t, err.Error(), c.msg)
+		}
+	}
+}
+
+func TestPipeline_EngineSettings(t *testing.T) {
+	registry := NewRegistry()
+	modName := uuid.NewString()
+	assert.NoError(t, registry.Register(NewSimpleModule(modName, func(name string, config interface{}) (ModuleInstance, error) {
+		return NewSimpleModuleInstance(modName, name, func(ctx context.Context, modCtx ModuleContext) error {
+			<-ctx.Done()
+			return nil
+		}), nil
+	})))
+	// 只注册在 Engine 的注册表中的模块也可以 Build, 由 RunConfig 按 Engine 的设置校验与填充默认值
+	cfg, err := NewPipeline().Source("Source", modName, nil).Then("Sink", modName, nil).Build()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, cfg.Engine["Sink"].Parallels)
+
+	err = NewEngine().RunConfig(context.Background(), cfg)
+	assert.ErrorContains(t, err, "module "+modName+" not exists")
+
+	eng := NewEngine(EngineWithRegistry(registry), EngineWithNodeDefaults(NodeDefaults{QueueSize: 4, Parallels: 3}))
+	assert.NoError(t, eng.RunConfig(context.Background(), cfg))
+	defer eng.Stop()
+	stats := eng.Stats()
+	assert.Equal(t, 3, stats[1].Parallels)
+	assert.Equal(t, 4, stats[1].QueueCap)
+}
@@ -0,0 +1,148 @@
+package gpipe
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// APIVersion gpipe 对插件提供的 API 版本, 格式为 major.minor
+// 不兼容的修改增加 major, 兼容的新增增加 minor; 插件的 major 必须相同, minor 不能大于宿主的 minor
+const APIVersion = "1.0"
+
+const (
+	// PluginAPIVersionSymbol 插件需要导出的 API 版本变量, 类型为 string, 取值为编译插件时的 gpipe.APIVersion
+	PluginAPIVersionSymbol = "GpipeAPIVersion"
+	// PluginModulesSymbol 插件需要导出的函数, 类型为 func() []gpipe.ModuleFactory
+	PluginModulesSymbol = "GpipeModules"
+	pluginExt           = ".so"
+)
+
+var (
+	// loadedPlugins 已加载的插件文件 -> 其中的模块, 同一个 .so 在进程内只能加载一次, 多个 Engine 共享
+	loadedPlugins     = map[string][]ModuleFactory{}
+	loadedPluginsLock sync.Mutex
+)
+
+// LoadPlugins 加载 dir 下所有 .so 插件, 并将其中的模块注册到 registry
+// 插件需要导出 GpipeAPIVersion 与 GpipeModules, 例如
+//
+//	var GpipeAPIVersion = gpipe.APIVersion
+//
+//	func GpipeModules() []gpipe.ModuleFactory {
+//		return []gpipe.ModuleFactory{NewMyModule()}
+//	}
+func LoadPlugins(dir string, registry *Registry) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return newGPWError("load plugins failed: %s", err)
+	}
+	paths := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() && filepath.Ext(entry.Name()) == pluginExt {
+			paths = append(paths, filepath.Join(dir, entry.Name()))
+		}
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if err := LoadPlugin(path, registry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadPlugin 加载一个 .so 插件, 并将其中的模块注册到 registry
+// 已加载过的插件不会重复加载, registry 中已经注册的同一个模块会被跳过
+func LoadPlugin(path string, registry *Registry) error {
+	modules, err := openPluginOnce(path)
+	if err != nil {
+		return newGPWError("load plugin %s failed: %s", path, err)
+	}
+	for _, mod := range modules {
+		if exists, err := registry.Get(mod.Name()); err == nil && exists == mod {
+			continue
+		}
+		if err := registry.Register(mod); err != nil {
+			return newGPWError("load plugin %s failed: %s", path, err)
+		}
+	}
+	return nil
+}
+
+func openPluginOnce(path string) ([]ModuleFactory, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	loadedPluginsLock.Lock()
+	defer loadedPluginsLock.Unlock()
+	if modules, ok := loadedPlugins[abs]; ok {
+		return modules, nil
+	}
+	modules, err := openPlugin(abs)
+	if err != nil {
+		return nil, err
+	}
+	for i, mod := range modules {
+		if isNilFactory(mod) {
+			return nil, newGPWError("%s returned a nil module at index %d", PluginModulesSymbol, i)
+		}
+	}
+	loadedPlugins[abs] = modules
+	return modules, nil
+}
+
+// isNilFactory 插件可能返回 nil 或值为 nil 的指针, 调用其 Name 会 panic
+func isNilFactory(mod ModuleFactory) bool {
+	if mod == nil {
+		return true
+	}
+	v := reflect.ValueOf(mod)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
+
+// checkAPIVersion 检查插件编译时使用的 API 版本与当前版本是否兼容
+func checkAPIVersion(version string) error {
+	major, minor, ok := parseAPIVersion(version)
+	if !ok {
+		return newGPWError("invalid api version %q", version)
+	}
+	hostMajor, hostMinor, _ := parseAPIVersion(APIVersion)
+	if major != hostMajor || minor > hostMinor {
+		return newGPWError("plugin api version %s is incompatible with %s", version, APIVersion)
+	}
+	return nil
+}
+
+func parseAPIVersion(version string) (major, minor int, ok bool) {
+	parts := strings.Split(version, ".")
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	major, err1 := strconv.Atoi(parts[0])
+	minor, err2 := strconv.Atoi(parts[1])
+	return major, minor, err1 == nil && err2 == nil && major >= 0 && minor >= 0
+}
+
+// loadPlugins 加载 EngineWithPluginDir 指定目录下的插件, 每个 Engine 成功加载一次后不再重复加载
+// 加载失败时 (例如插件还未拷贝完成) 下次 Run / RunConfig / Validate 会重试
+func (e *Engine) loadPlugins() error {
+	if e.pluginDir == "" {
+		return nil
+	}
+	e.pluginsLock.Lock()
+	defer e.pluginsLock.Unlock()
+	if e.pluginsLoaded {
+		return nil
+	}
+	if err := LoadPlugins(e.pluginDir, e.registry); err != nil {
+		return err
+	}
+	e.pluginsLoaded = true
+	return nil
+}
@@ -0,0 +1,55 @@
+package gpipe
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckAPIVersion(t *testing.T) {
+	assert.NoError(t, checkAPIVersion(APIVersion))
+	assert.NoError(t, checkAPIVersion("1.0"))
+	assert.ErrorContains(t, checkAPIVersion("1.1"), "incompatible")
+	assert.ErrorContains(t, checkAPIVersion("2.0"), "incompatible")
+	assert.ErrorContains(t, checkAPIVersion("0.9"), "incompatible")
+	assert.ErrorContains(t, checkAPIVersion("1"), "invalid api version")
+	assert.ErrorContains(t, checkAPIVersion("v1.0"), "invalid api version")
+}
+
+func TestLoadPlugins(t *testing.T) {
+	dir := t.TempDir()
+	registry := NewRegistry()
+	// 非 .so 文件与目录被忽略
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("readme"), 0644))
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "sub.so"), 0755))
+	assert.NoError(t, LoadPlugins(dir, registry))
+	assert.Empty(t, registry.List())
+
+	assert.ErrorContains(t, LoadPlugins(filepath.Join(dir, "missing"), registry), "load plugins failed")
+
+	bad := filepath.Join(dir, "bad.so")
+	assert.NoError(t, os.WriteFile(bad, []byte("not a plugin"), 0644))
+	assert.ErrorContains(t, LoadPlugins(dir, registry), "load plugin "+bad+" failed")
+
+	eng := NewEngine(EngineWithPluginDir(dir), EngineWithRegistry(registry))
+	err := eng.Run(context.Background(), strings.NewReader("engine: {}"))
+	assert.ErrorContains(t, err, "load plugin "+bad+" failed")
+	_, err = eng.Validate(strings.NewReader("engine: {}"))
+	assert.ErrorContains(t, err, "load plugin "+bad+" failed")
+
+	// 失败的加载不会被缓存, 修复插件目录后再次启动即可
+	assert.NoError(t, os.Remove(bad))
+	_, err = eng.Validate(strings.NewReader("engine: {}"))
+	assert.NoError(t, err)
+	assert.True(t, eng.pluginsLoaded)
+}
+
+func TestIsNilFactory(t *testing.T) {
+	var typed *simpleModule
+	assert.True(t, isNilFactory(nil))
+	assert.True(t, isNilFactory(typed))
+	assert.False(t, isNilFactory(NewSimpleModule("mod", nil)))
+}
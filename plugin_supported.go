@@ -0,0 +1,34 @@
+//go:build (linux || darwin || freebsd) && cgo
+
+package gpipe
+
+import (
+	"plugin"
+)
+
+// openPlugin 打开 .so 并读取其中的模块, 需要 cgo, 且插件与宿主必须使用相同版本的 Go 与依赖编译
+func openPlugin(path string) ([]ModuleFactory, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	versionSymbol, err := p.Lookup(PluginAPIVersionSymbol)
+	if err != nil {
+		return nil, err
+	}
+	version, ok := versionSymbol.(*string)
+	if !ok {
+		return nil, newGPWError("%s must be a string variable", PluginAPIVersionSymbol)
+	} else if err := checkAPIVersion(*version); err != nil {
+		return nil, err
+	}
+	modulesSymbol, err := p.Lookup(PluginModulesSymbol)
+	if err != nil {
+		return nil, err
+	}
+	modules, ok := modulesSymbol.(func() []ModuleFactory)
+	if !ok {
+		return nil, newGPWError("%s must be func() []gpipe.ModuleFactory", PluginModulesSymbol)
+	}
+	return modules(), nil
+}
@@ -0,0 +1,8 @@
+//go:build !((linux || darwin || freebsd) && cgo)
+
+package gpipe
+
+// openPlugin Go 的 plugin 包仅支持 linux / darwin / freebsd 且需要开启 cgo
+func openPlugin(path string) ([]ModuleFactory, error) {
+	return nil, newGPWError("plugins are not supported on this platform")
+}
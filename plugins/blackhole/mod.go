@@ -20,5 +20,9 @@ func NewBlackHoleModule() gpipe.ModuleFactory {
 			}
 			return nil
 		}), nil
-	})
+	}, gpipe.SimpleModuleWithInfo(gpipe.ModuleMetadata{
+		Description: "黑洞, 所有进来的消息都被丢弃",
+		Version:     "1.0.0",
+		Input:       "any",
+	}))
 }
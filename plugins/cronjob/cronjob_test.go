@@ -2,6 +2,9 @@ package interval
 
 import (
 	"context"
+	"github.com/google/uuid"
+	"github.com/nosuchperson/gpipe"
+	"github.com/nosuchperson/gpipe/gpipetest"
 	"github.com/stretchr/testify/assert"
 	"strings"
 	"testing"
@@ -9,20 +12,24 @@ import (
 )
 
 func TestCronJob(t *testing.T) {
-	afterDone := ""
-	if err := gpipe.RegisterModule(gpipe.NewSimpleModule("test", func(name string, config interface{}) (gpipe.ModuleInstance, error) {
-		return gpipe.NewSimpleModuleInstance("test", name, func(ctx context.Context, modCtx gpipe.ModuleContext) error {
+	afterDone := make(chan string, 1)
+	testName := uuid.NewString()
+	if err := gpipe.RegisterModule(gpipe.NewSimpleModule(testName, func(name string, config interface{}) (gpipe.ModuleInstance, error) {
+		return gpipe.NewSimpleModuleInstance(testName, name, func(ctx context.Context, modCtx gpipe.ModuleContext) error {
 			select {
 			case s := <-modCtx.MessageQueue():
-				afterDone = s.(string)
+				afterDone <- s.(string)
+				return nil
+			case <-ctx.Done():
 				return nil
 			}
-			return nil
 		}), nil
 	})); err != nil {
 		t.Fatal(err)
 	}
-	gpipe.NewEngine().Run(context.Background(), strings.NewReader(`
+	clock := gpipetest.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	eng := gpipe.NewEngine(gpipe.EngineWithClock(clock))
+	assert.NoError(t, eng.Run(context.Background(), strings.NewReader(`
 engine:
   IntervalCall:
     module: timer/cronjob 
@@ -35,13 +42,39 @@ engine:
         tag: "hello"
 
   Test:
-    module: test
+    module: `+testName+`
     parent:
     - IntervalCall
     queueSize: 1
     parallels: 1
     config: { }
-`))
-	time.Sleep(time.Second * 2)
-	assert.Equal(t, "hello", afterDone)
+`)))
+	defer eng.Stop()
+	// 两个节点 QPS 统计的 ticker 以及 cronjob 的定时器
+	clock.BlockUntil(3)
+	clock.Advance(time.Second)
+	assert.Equal(t, "hello", <-afterDone)
+}
+
+func TestCronJob_Schedule(t *testing.T) {
+	inst, err := gpipe.GetModuleByName(moduleName)
+	assert.NoError(t, err)
+	_, err = inst.New("Cron", map[string]interface{}{"jobs": []interface{}{
+		map[string]interface{}{"cronjob": "invalid", "tag": "x"},
+	}})
+	assert.ErrorContains(t, err, "invalid crontab [invalid]")
+
+	modInst, err := inst.New("Cron", map[string]interface{}{"jobs": []interface{}{
+		map[string]interface{}{"cronjob": "*/2 * * * * *", "tag": "even"},
+		map[string]interface{}{"cronjob": "*/3 * * * * *", "tag": "three"},
+	}})
+	assert.NoError(t, err)
+	clock := gpipetest.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	h := gpipetest.Start(t, modInst, gpipetest.WithClock(clock))
+	for i := 0; i < 6; i++ {
+		clock.BlockUntil(1)
+		clock.Advance(time.Second)
+	}
+	h.AssertOutputs("even", "three", "even", "even", "three")
+	assert.NoError(t, h.Stop())
 }
@@ -6,50 +6,93 @@ import (
 	"fmt"
 	"github.com/nosuchperson/gpipe"
 	"github.com/robfig/cron/v3"
+	"time"
 )
 
 const (
 	moduleName = "timer/cronjob"
 )
 
+var cronParser = cron.NewParser(
+	cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor,
+)
+
 type cronjobConfiguration struct {
 	Jobs []struct {
 		Cronjob string `yaml:"cronjob"`
 		Tag     string `yaml:"tag"`
-	} `yaml:"jobs"`
+	} `yaml:"jobs" doc:"定时任务列表, cronjob 为带秒的 crontab 表达式, 触发时向下游发送 tag"`
+}
+
+type cronjob struct {
+	spec     string
+	tag      string
+	schedule cron.Schedule
 }
 
 func init() {
 	gpipe.RegisterModule(func() gpipe.ModuleFactory {
 		return gpipe.NewSimpleModule(moduleName, func(name string, config interface{}) (gpipe.ModuleInstance, error) {
 			// 解析 config
-			if configMap, err := gpipe.ConfigMapUnmarshal(config, &cronjobConfiguration{}); err != nil {
+			configMap, err := gpipe.ConfigMapUnmarshal(config, &cronjobConfiguration{})
+			if err != nil {
 				return nil, errors.New(fmt.Sprintf("%s: invalid configuration, err = %v", moduleName, err))
-			} else {
-				return gpipe.NewSimpleModuleInstance(moduleName, name, func(ctx context.Context, modCtx gpipe.ModuleContext) error {
-					cronParser := cron.New(cron.WithParser(cron.NewParser(
-						cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor,
-					)))
-
-					for _, job := range configMap.Jobs {
-						if entityId, err := cronParser.AddJob(job.Cronjob, cron.FuncJob(func() {
-							handleCronJob(ctx, modCtx, job.Cronjob, job.Tag)
-						})); err != nil {
-							modCtx.Logger().Error(modCtx, "failed to add cronjob, crontab: [%s], tag: [%s], err = %v", job.Cronjob, job.Tag, err)
-						} else {
-							modCtx.Logger().Trace(modCtx, "added cronjob, crontab: [%s], tag: [%s], entityId: [%d]", job.Cronjob, job.Tag, entityId)
-						}
-					}
-					cronParser.Start()
-					<-ctx.Done()
-					<-cronParser.Stop().Done()
-					return nil
-				}), nil
 			}
-		})
+			jobs := []*cronjob{}
+			for _, job := range configMap.Jobs {
+				schedule, err := cronParser.Parse(job.Cronjob)
+				if err != nil {
+					return nil, fmt.Errorf("%s: invalid crontab [%s], tag: [%s], err = %v", moduleName, job.Cronjob, job.Tag, err)
+				}
+				jobs = append(jobs, &cronjob{spec: job.Cronjob, tag: job.Tag, schedule: schedule})
+			}
+			return gpipe.NewSimpleModuleInstance(moduleName, name, func(ctx context.Context, modCtx gpipe.ModuleContext) error {
+				return runCronJobs(ctx, modCtx, jobs)
+			}), nil
+		}, gpipe.SimpleModuleWithConfigSchema(&cronjobConfiguration{}), gpipe.SimpleModuleWithInfo(gpipe.ModuleMetadata{
+			Description: "按照 crontab 定时触发, 向下游发送对应任务的 tag",
+			Version:     "1.0.0",
+			Output:      "string",
+		}))
 	}())
 }
 
+// runCronJobs 使用 ModuleContext 的时钟等待最近一次触发, 到期的任务按配置顺序触发
+// 与 robfig/cron 相同, 错过的触发 (例如下游阻塞) 不会补发
+func runCronJobs(ctx context.Context, modCtx gpipe.ModuleContext, jobs []*cronjob) error {
+	if len(jobs) == 0 {
+		<-ctx.Done()
+		return nil
+	}
+	clock := modCtx.Clock()
+	now := clock.Now()
+	// 每个 parallel 独立记录各任务的下次触发时间
+	nexts := make([]time.Time, len(jobs))
+	for i, job := range jobs {
+		nexts[i] = job.schedule.Next(now)
+	}
+	for {
+		next := nexts[0]
+		for _, t := range nexts[1:] {
+			if t.Before(next) {
+				next = t
+			}
+		}
+		select {
+		case _ = <-ctx.Done():
+			return nil
+		case _ = <-clock.After(next.Sub(clock.Now())):
+		}
+		now = clock.Now()
+		for i, job := range jobs {
+			if !nexts[i].After(now) {
+				handleCronJob(ctx, modCtx, job.spec, job.tag)
+				nexts[i] = job.schedule.Next(now)
+			}
+		}
+	}
+}
+
 func handleCronJob(ctx context.Context, modCtx gpipe.ModuleContext, cronjob string, tag string) {
 	modCtx.Logger().Trace(modCtx, "cronjob triggered, crontab: [%s], tag: [%s]", cronjob, tag)
 	modCtx.Collect(tag)
@@ -6,4 +6,7 @@ import (
 	_ "github.com/nosuchperson/gpipe/plugins/interval"
 	_ "github.com/nosuchperson/gpipe/plugins/kafka"
 	_ "github.com/nosuchperson/gpipe/plugins/printer"
+	_ "github.com/nosuchperson/gpipe/plugins/process"
+	_ "github.com/nosuchperson/gpipe/plugins/script"
+	_ "github.com/nosuchperson/gpipe/plugins/wasm"
 )
@@ -3,7 +3,10 @@ package interval
 import (
 	"context"
 	"fmt"
+	"github.com/google/uuid"
 	"github.com/nosuchperson/gpipe"
+	"github.com/nosuchperson/gpipe/gpipetest"
+	"github.com/stretchr/testify/assert"
 	"strings"
 	"testing"
 	"time"
@@ -11,16 +14,19 @@ import (
 
 func TestInterval(t *testing.T) {
 	TEST_INTERVAL := 1000
-	eng := gpipe.NewEngine()
-	if err := gpipe.RegisterModule(gpipe.NewSimpleModule("test", func(name string, config interface{}) (gpipe.ModuleInstance, error) {
-		return gpipe.NewSimpleModuleInstance("test", name, func(ctx context.Context, modCtx gpipe.ModuleContext) error {
+	clock := gpipetest.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	eng := gpipe.NewEngine(gpipe.EngineWithClock(clock))
+	received := make(chan struct{})
+	testName := uuid.NewString()
+	if err := gpipe.RegisterModule(gpipe.NewSimpleModule(testName, func(name string, config interface{}) (gpipe.ModuleInstance, error) {
+		return gpipe.NewSimpleModuleInstance(testName, name, func(ctx context.Context, modCtx gpipe.ModuleContext) error {
 			select {
-			case _ = <-time.After(time.Duration(TEST_INTERVAL) * time.Millisecond * 2): // 两倍时间等待
-				t.Fatal("can't recv event")
+			case _ = <-ctx.Done():
+				return nil
 			case _ = <-modCtx.MessageQueue():
+				close(received)
 				return nil
 			}
-			return nil
 		}), nil
 	})); err != nil {
 		t.Fatal(err)
@@ -32,22 +38,60 @@ engine:
     parent: [ ]
     queueSize: 1
     parallels: 1
+    config:
+      interval: %d
 
   Test:
-    module: test
+    module: %s
     parent:
     - IntervalCall
     queueSize: 1
     parallels: 1
-
-config:
-  IntervalCall:
-    interval: %d
-
-  Test: {}
-`, TEST_INTERVAL)
+    config: {}
+`, TEST_INTERVAL, testName)
 	if err := eng.Run(context.Background(), strings.NewReader(cfg)); err != nil {
 		t.Fatal(err)
 	}
-	time.Sleep(time.Millisecond * time.Duration(TEST_INTERVAL) * 5) // 5 倍原始时间等 fatal 就好
+	defer eng.Stop()
+	// 两个节点 QPS 统计的 ticker 以及 interval 的定时器
+	clock.BlockUntil(3)
+	clock.Advance(time.Duration(TEST_INTERVAL-1) * time.Millisecond)
+	select {
+	case <-received:
+		t.Fatal("received event before interval")
+	default:
+	}
+	clock.Advance(time.Millisecond)
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("can't recv event")
+	}
+}
+
+func TestInterval_Harness(t *testing.T) {
+	inst, err := NewIntervalModule().New("Interval", map[string]interface{}{"interval": 500})
+	assert.NoError(t, err)
+	clock := gpipetest.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	h := gpipetest.Start(t, inst, gpipetest.WithClock(clock))
+	for i := 0; i < 3; i++ {
+		clock.BlockUntil(1)
+		clock.Advance(500 * time.Millisecond)
+	}
+	h.AssertOutputs(nil, nil, nil)
+	assert.NoError(t, h.Stop())
+}
+
+func TestInterval_Alias(t *testing.T) {
+	// 内置模块不注册别名, 需要短名称时在自己的注册表中添加
+	registry := gpipe.NewRegistry()
+	assert.NoError(t, registry.Register(NewIntervalModule()))
+	_, err := registry.Get("interval")
+	assert.Error(t, err)
+	assert.NoError(t, registry.Alias("interval", "timer/interval"))
+	mod, err := registry.Get("interval")
+	assert.NoError(t, err)
+	assert.Equal(t, "timer/interval", mod.Name())
+	_, err = gpipe.DefaultRegistry().Get("interval")
+	assert.Error(t, err)
 }
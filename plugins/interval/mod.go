@@ -13,7 +13,7 @@ const (
 )
 
 type intervalConfig struct {
-	Interval int `yaml:"interval"`
+	Interval int `yaml:"interval" doc:"发送信号的间隔, 单位 ms"`
 }
 
 func init() {
@@ -28,17 +28,21 @@ func NewIntervalModule() gpipe.ModuleFactory {
 		} else {
 			return gpipe.NewSimpleModuleInstance(intervalModuleName, name, func(ctx context.Context, modCtx gpipe.ModuleContext) error {
 				delay := time.Millisecond * time.Duration(configMap.Interval)
-				sign := time.After(delay)
+				sign := modCtx.Clock().After(delay)
 				for {
 					select {
 					case _ = <-ctx.Done():
 						return nil
 					case _ = <-sign:
 						modCtx.Collect(nil)
-						sign = time.After(delay)
+						sign = modCtx.Clock().After(delay)
 					}
 				}
 			}), nil
 		}
-	})
+	}, gpipe.SimpleModuleWithConfigSchema(&intervalConfig{}), gpipe.SimpleModuleWithInfo(gpipe.ModuleMetadata{
+		Description: "定时信号, 每隔 interval 毫秒向下游发送一个 nil",
+		Version:     "1.0.0",
+		Output:      "nil",
+	}))
 }
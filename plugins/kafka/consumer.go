@@ -2,17 +2,17 @@ package kafka
 
 import (
 	"context"
-	"fmt"
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
 	"github.com/nosuchperson/gpipe"
+	"go.opentelemetry.io/otel"
 )
 
 const kafkaConsumerModuleName = "kafka/consumer"
 
 type kafkaConsumerConfig struct {
-	Topics []string        `yaml:"topics"`
-	PollMs int             `yaml:"pollMs"`
-	Config kafka.ConfigMap `yaml:"config"`
+	Topics []string        `yaml:"topics" doc:"订阅的 topic 列表"`
+	PollMs int             `yaml:"pollMs" doc:"每次 Poll 的超时时间, 单位 ms"`
+	Config kafka.ConfigMap `yaml:"config" doc:"librdkafka 的配置, 参考 https://github.com/edenhill/librdkafka/blob/master/CONFIGURATION.md"`
 }
 
 type kafkaConsumerModule struct {
@@ -37,7 +37,11 @@ func NewKafkaConsumerModule() gpipe.ModuleFactory {
 				kafkaConfigMap: configMap.Config,
 			}, nil
 		}
-	})
+	}, gpipe.SimpleModuleWithConfigSchema(&kafkaConsumerConfig{}), gpipe.SimpleModuleWithInfo(gpipe.ModuleMetadata{
+		Description: "kafka 消费者, 将消息的 Value 发送给下游, 并从消息头中还原 trace 信息",
+		Version:     "1.0.0",
+		Output:      "[]byte",
+	}))
 }
 
 func (k *kafkaConsumerModule) ModuleName() string {
@@ -87,14 +91,16 @@ func (k *kafkaConsumerModule) consumer(ctx context.Context, modCtx gpipe.ModuleC
 			}
 			switch e := ev.(type) {
 			case *kafka.Message:
-				modCtx.Collect(e.Value)
+				// 从消息头中还原上游的 trace 信息
+				msgCtx := otel.GetTextMapPropagator().Extract(ctx, headerCarrier{&e.Headers})
+				modCtx.CollectWithContext(msgCtx, e.Value)
 			case kafka.Error:
 				// Errors should generally be considered
 				// informational, the client will try to
 				// automatically recover.
 				// But in this example we choose to terminate
 				// the application if all brokers are down.
-				fmt.Printf("%% Error: %v: %v\n", e.Code(), e)
+				modCtx.Logger().Error(modCtx, "kafka consumer error: %v: %v", e.Code(), e)
 				if e.Code() == kafka.ErrAllBrokersDown {
 					return e
 				}
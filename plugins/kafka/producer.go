@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
 	"github.com/nosuchperson/gpipe"
+	"go.opentelemetry.io/otel"
 	"gopkg.in/yaml.v3"
 	"sync"
 	"time"
@@ -22,18 +23,24 @@ const (
 )
 
 type kafkaProducerConfig struct {
-	Topic      string                  `yaml:"topic"`
-	Async      bool                    `yaml:"async"`
-	Serializer kafkaProducerSerializer `yaml:"serializer"`
+	Topic      string                  `yaml:"topic" doc:"写入的 topic"`
+	Async      bool                    `yaml:"async" default:"false" doc:"是否通过 ProduceChannel 异步写入"`
+	Serializer kafkaProducerSerializer `yaml:"serializer" doc:"json / yaml, 为空时要求输入为 []byte"`
 	// configMap Ref: https://github.com/edenhill/librdkafka/blob/master/CONFIGURATION.md
 	// 突然发现直接从配置撸这个不香么？改啥程序。。。
-	RdKafka kafka.ConfigMap `yaml:"rdKafka"`
+	RdKafka kafka.ConfigMap `yaml:"rdKafka" doc:"librdkafka 的配置"`
 }
 
 type kafkaProducerModule struct {
 	name           string
 	kafkaConfigMap *kafkaProducerConfig
 	kafkaMsgPool   sync.Pool
+	kafkaProducer  *kafka.Producer // 所有 parallel 共享, 在 Init 中创建, Close 中释放
+	monitorCancel  context.CancelFunc
+	monitorDone    chan struct{}
+	monitorOnce    sync.Once
+	monitorCtx     gpipe.ModuleContext // 第一个启动的 parallel 的 context, 事件监控使用它输出日志
+	monitorReady   chan struct{}       // monitorCtx 设置后关闭
 }
 
 func init() {
@@ -64,50 +71,57 @@ func NewKafkaProducerModule() gpipe.ModuleFactory {
 				}},
 			}, nil
 		}
-	})
+	}, gpipe.SimpleModuleWithConfigSchema(&kafkaProducerConfig{}), gpipe.SimpleModuleWithInfo(gpipe.ModuleMetadata{
+		Description: "kafka 生产者, 将收到的消息序列化后写入 topic, 并将 trace 信息写入消息头",
+		Version:     "1.0.0",
+		Input:       "[]byte, or any with serializer",
+	}))
 }
 
-func (k *kafkaProducerModule) Core(ctx context.Context, modCtx gpipe.ModuleContext) error {
-	for {
-		select {
-		case _ = <-ctx.Done():
-			return nil
-		default:
-			k.producer(ctx, modCtx)
-		}
-	}
-}
-
-func (k *kafkaProducerModule) producer(ctx context.Context, modCtx gpipe.ModuleContext) {
-	// 注意，这个函数产生的生产者并不是线程安全的，所以必须初始化在工作线程中
+// Init 创建 producer 并启动事件监控, kafka.Producer 可以被多个 parallel 并发使用
+func (k *kafkaProducerModule) Init(ctx context.Context) error {
 	kafkaProducer, err := kafka.NewProducer(&k.kafkaConfigMap.RdKafka)
 	if err != nil {
-		modCtx.Logger().Error(modCtx, "kafka producer init failed due to %c", err)
+		return err
 	}
-	defer func() {
-		// 刷新 Kafka 并且安心退出
-		kafkaProducer.Flush(1000 * 10)
-		kafkaProducer.Close()
+	k.kafkaProducer = kafkaProducer
+	monitorCtx, cancel := context.WithCancel(context.Background())
+	k.monitorCancel = cancel
+	k.monitorDone = make(chan struct{})
+	k.monitorReady = make(chan struct{})
+	go func() {
+		defer close(k.monitorDone)
+		// 等待 Core 启动后再处理事件, 以便通过 ModuleContext 输出日志
+		select {
+		case _ = <-monitorCtx.Done():
+			return
+		case _ = <-k.monitorReady:
+		}
+		k.monitorEvent(monitorCtx, k.monitorCtx, kafkaProducer.Events())
 	}()
-	prodCtx, cancel := context.WithCancel(ctx)
-	defer cancel()
-	eventCh := kafkaProducer.Events()
-	// 启动监控
-	go k.monitorEvent(prodCtx, eventCh)
+	return nil
+}
 
+func (k *kafkaProducerModule) Core(ctx context.Context, modCtx gpipe.ModuleContext) error {
+	k.monitorOnce.Do(func() {
+		k.monitorCtx = modCtx
+		close(k.monitorReady)
+	})
 	serializerFunc := k.generateSerializer(modCtx)
-	producer := k.generateProducer(kafkaProducer, eventCh)
+	producer := k.generateProducer(k.kafkaProducer, k.kafkaProducer.Events())
 
 	for {
 		select {
-		case _ = <-prodCtx.Done():
-			return
+		case _ = <-ctx.Done():
+			return nil
 		case msg := <-modCtx.MessageQueue():
 			if body, err := serializerFunc(msg); err != nil {
 				modCtx.Logger().Error(modCtx, "serializing input data failed due to %v", err)
 			} else {
 				kMsg := k.kafkaMsgPool.Get().(*kafka.Message)
 				kMsg.Value = body
+				kMsg.Headers = kMsg.Headers[:0]
+				otel.GetTextMapPropagator().Inject(modCtx.Context(), headerCarrier{&kMsg.Headers})
 				if err := producer(kMsg); err != nil {
 					modCtx.Logger().Error(modCtx, "kafkaProducer.producer() failed due to %v", err)
 				}
@@ -116,7 +130,27 @@ func (k *kafkaProducerModule) producer(ctx context.Context, modCtx gpipe.ModuleC
 	}
 }
 
-func (k *kafkaProducerModule) monitorEvent(ctx context.Context, evCh chan kafka.Event) {
+// Flush 所有 parallel 退出后等待未发送的消息写入 kafka, 直到 ctx 超时
+func (k *kafkaProducerModule) Flush(ctx context.Context) error {
+	timeoutMs := 1000 * 10
+	if deadline, ok := ctx.Deadline(); ok {
+		timeoutMs = int(time.Until(deadline).Milliseconds())
+	}
+	if remain := k.kafkaProducer.Flush(timeoutMs); remain > 0 {
+		return fmt.Errorf("%d messages are still in queue after flush", remain)
+	}
+	return nil
+}
+
+// Close 先停止事件监控, 再关闭 producer
+func (k *kafkaProducerModule) Close() error {
+	k.monitorCancel()
+	<-k.monitorDone
+	k.kafkaProducer.Close()
+	return nil
+}
+
+func (k *kafkaProducerModule) monitorEvent(ctx context.Context, modCtx gpipe.ModuleContext, evCh chan kafka.Event) {
 	for {
 		select {
 		case _ = <-ctx.Done():
@@ -137,9 +171,9 @@ func (k *kafkaProducerModule) monitorEvent(ctx context.Context, evCh chan kafka.
 				// as the underlying client will automatically try to
 				// recover from any errors encountered, the application
 				// does not need to take action on them.
-				fmt.Printf("KafkProducerError: %v\n", ev)
+				modCtx.Logger().Error(modCtx, "kafka producer error: %v", ev)
 			default:
-				fmt.Printf("KafkaProducerIgnored event: %s\n", ev)
+				modCtx.Logger().Trace(modCtx, "kafka producer ignored event: %s", ev)
 			}
 		}
 	}
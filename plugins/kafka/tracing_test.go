@@ -0,0 +1,27 @@
+package kafka
+
+import (
+	"context"
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"testing"
+)
+
+func TestHeaderCarrier(t *testing.T) {
+	spanCtx := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1, 2, 3},
+		SpanID:     trace.SpanID{4, 5, 6},
+		TraceFlags: trace.FlagsSampled,
+	})
+	headers := []kafka.Header{{Key: "other", Value: []byte("value")}}
+	propagator := propagation.TraceContext{}
+	propagator.Inject(trace.ContextWithSpanContext(context.Background(), spanCtx), headerCarrier{&headers})
+	assert.ElementsMatch(t, []string{"other", "traceparent"}, headerCarrier{&headers}.Keys())
+
+	extracted := trace.SpanContextFromContext(propagator.Extract(context.Background(), headerCarrier{&headers}))
+	assert.Equal(t, spanCtx.TraceID(), extracted.TraceID())
+	assert.Equal(t, spanCtx.SpanID(), extracted.SpanID())
+	assert.True(t, extracted.IsRemote())
+}
@@ -22,5 +22,9 @@ func init() {
 				}
 			}
 		}), nil
-	}))
+	}, gpipe.SimpleModuleWithInfo(gpipe.ModuleMetadata{
+		Description: "将收到的消息以 %s 格式打印到标准输出",
+		Version:     "1.0.0",
+		Input:       "any",
+	})))
 }
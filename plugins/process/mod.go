@@ -0,0 +1,216 @@
+package process
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/nosuchperson/gpipe"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+)
+
+const (
+	moduleName = "exec/process"
+)
+
+type processConfig struct {
+	Command        string            `yaml:"command" doc:"可执行文件"`
+	Args           []string          `yaml:"args" doc:"命令行参数"`
+	Env            map[string]string `yaml:"env" doc:"追加到当前进程环境变量之后的环境变量"`
+	Dir            string            `yaml:"dir" doc:"工作目录"`
+	RestartDelayMs int               `yaml:"restartDelayMs" default:"1000" doc:"子进程退出后重启的等待时间, 单位 ms"`
+	MaxRestarts    int               `yaml:"maxRestarts" default:"-1" doc:"最大重启次数, 超过后 parallel 以错误退出, -1 为不限制"`
+	StopTimeoutMs  int               `yaml:"stopTimeoutMs" default:"5000" doc:"停止时关闭 stdin 后等待子进程退出的时间, 超时后 kill, 单位 ms"`
+}
+
+type processModule struct {
+	name   string
+	config *processConfig
+}
+
+func init() {
+	gpipe.RegisterModule(NewProcessModule())
+}
+
+func NewProcessModule() gpipe.ModuleFactory {
+	return gpipe.NewSimpleModule(moduleName, func(name string, config interface{}) (gpipe.ModuleInstance, error) {
+		configMap, err := gpipe.ConfigMapUnmarshal(config, &processConfig{RestartDelayMs: 1000, MaxRestarts: -1, StopTimeoutMs: 5000})
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid configuration, err = %v", moduleName, err)
+		} else if configMap.Command == "" {
+			return nil, fmt.Errorf("%s: command is required", moduleName)
+		}
+		return &processModule{name: name, config: configMap}, nil
+	}, gpipe.SimpleModuleWithConfigSchema(&processConfig{}), gpipe.SimpleModuleWithInfo(gpipe.ModuleMetadata{
+		Description: "每个 parallel 启动一个子进程, 通过 stdin / stdout 上的 length-prefixed JSON frame 交换消息, 子进程退出后自动重启",
+		Version:     "1.0.0",
+		Input:       "any, encoded as JSON",
+		Output:      "[]byte, JSON",
+	}))
+}
+
+// Core 运行子进程直到 ctx 结束, 子进程意外退出时按配置重启
+// 子进程退出时已写入其 stdin 但未处理的消息会丢失
+func (p *processModule) Core(ctx context.Context, modCtx gpipe.ModuleContext) error {
+	for restarts := 0; ; restarts++ {
+		err := p.run(ctx, modCtx)
+		if ctx.Err() != nil {
+			return nil
+		} else if p.config.MaxRestarts >= 0 && restarts >= p.config.MaxRestarts {
+			return fmt.Errorf("process %s exited after %d restarts: %v", p.config.Command, restarts, err)
+		}
+		modCtx.Logger().Error(modCtx, "process %s exited: %v, restarting in %dms", p.config.Command, err, p.config.RestartDelayMs)
+		select {
+		case _ = <-ctx.Done():
+			return nil
+		case _ = <-modCtx.Clock().After(time.Duration(p.config.RestartDelayMs) * time.Millisecond):
+		}
+	}
+}
+
+// run 启动一次子进程, 返回子进程退出的原因
+// 背压: 子进程处理不过来时写 stdin 阻塞, 节点队列随之堆积; 下游处理不过来时 Collect 阻塞, 子进程写 stdout 随之阻塞
+func (p *processModule) run(ctx context.Context, modCtx gpipe.ModuleContext) error {
+	cmd := exec.Command(p.config.Command, p.config.Args...)
+	cmd.Dir = p.config.Dir
+	cmd.Env = os.Environ()
+	for k, v := range p.config.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	var waitErr error
+	waitDone := make(chan struct{})
+	go func() {
+		defer close(waitDone)
+		stderrDone := make(chan struct{})
+		go func() {
+			defer close(stderrDone)
+			p.forwardStderr(modCtx, stderr)
+		}()
+		readErr := p.readLoop(modCtx, stdout)
+		if readErr != nil {
+			// 协议错误后无法继续解析 stdout, kill 子进程以便重启
+			modCtx.Logger().Error(modCtx, "reading frame from process %s failed due to %v", p.config.Command, readErr)
+			cmd.Process.Kill()
+		}
+		// 必须在 stdout / stderr 读取结束后才能调用 Wait
+		<-stderrDone
+		waitErr = errors.Join(cmd.Wait(), readErr)
+	}()
+	go func() {
+		// 停止时关闭 stdin 通知子进程退出, 超时后 kill
+		select {
+		case _ = <-ctx.Done():
+			stdin.Close()
+			select {
+			case _ = <-waitDone:
+			case _ = <-modCtx.Clock().After(time.Duration(p.config.StopTimeoutMs) * time.Millisecond):
+				cmd.Process.Kill()
+			}
+		case _ = <-waitDone:
+		}
+	}()
+
+	writer := bufio.NewWriter(stdin)
+	for {
+		select {
+		case _ = <-ctx.Done():
+			<-waitDone
+			return nil
+		case _ = <-waitDone:
+			return exitError(waitErr)
+		case msg := <-modCtx.MessageQueue():
+			data, err := encodeMessage(msg)
+			if err != nil {
+				modCtx.Logger().Error(modCtx, "encoding input data failed due to %v", err)
+				continue
+			}
+			if err := WriteFrame(writer, &Frame{Type: FrameMessage, Data: data}); err == nil {
+				err = writer.Flush()
+			}
+			if err != nil {
+				// 子进程已退出或关闭了 stdin
+				cmd.Process.Kill()
+				<-waitDone
+				return errors.Join(err, exitError(waitErr))
+			}
+		}
+	}
+}
+
+func (p *processModule) readLoop(modCtx gpipe.ModuleContext, stdout io.Reader) error {
+	reader := bufio.NewReader(stdout)
+	for {
+		frame, err := ReadFrame(reader)
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		switch frame.Type {
+		case FrameMessage:
+			modCtx.Collect([]byte(frame.Data))
+		case FrameLog:
+			p.log(modCtx, frame.Level, frame.Message)
+		}
+	}
+}
+
+func (p *processModule) forwardStderr(modCtx gpipe.ModuleContext, stderr io.Reader) {
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		modCtx.Logger().Warn(modCtx, "stderr: %s", scanner.Text())
+	}
+}
+
+func (p *processModule) log(modCtx gpipe.ModuleContext, level, message string) {
+	switch level {
+	case "trace":
+		modCtx.Logger().Trace(modCtx, "%s", message)
+	case "warn":
+		modCtx.Logger().Warn(modCtx, "%s", message)
+	case "error":
+		modCtx.Logger().Error(modCtx, "%s", message)
+	default:
+		modCtx.Logger().Info(modCtx, "%s", message)
+	}
+}
+
+// encodeMessage 将消息编码为 JSON, 内容本身是 JSON 的 []byte 原样发送
+func encodeMessage(msg interface{}) (json.RawMessage, error) {
+	switch v := msg.(type) {
+	case json.RawMessage:
+		return v, nil
+	case []byte:
+		if json.Valid(v) {
+			return v, nil
+		}
+	}
+	return json.Marshal(msg)
+}
+
+func exitError(err error) error {
+	if err == nil {
+		return errors.New("process exited")
+	}
+	return err
+}
@@ -0,0 +1,218 @@
+package process
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/nosuchperson/gpipe"
+	"github.com/nosuchperson/gpipe/gpipetest"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestHelperProcess 不是真正的测试, 作为子进程运行时使用参考客户端 Serve 处理消息
+func TestHelperProcess(t *testing.T) {
+	mode := os.Getenv("GPIPE_PROCESS_HELPER")
+	if mode == "" {
+		return
+	} else if mode == "exit" {
+		os.Exit(0)
+	} else if mode == "malformed" {
+		// 写出无法解析的 frame 后不退出, 需要由引擎 kill
+		os.Stderr.WriteString("writing malformed frame\n")
+		os.Stdout.Write([]byte{0, 0, 0, 1, '{'})
+		time.Sleep(time.Hour)
+		os.Exit(0)
+	}
+	err := Serve(os.Stdin, os.Stdout, func(data json.RawMessage, emit func(v interface{}) error) error {
+		n := 0
+		if err := json.Unmarshal(data, &n); err != nil {
+			return err
+		}
+		// crash 模式下第一次收到 5 时退出, 通过标记文件区分是否已经重启过
+		if marker := os.Getenv("GPIPE_PROCESS_MARKER"); mode == "crash" && n == 5 {
+			if _, err := os.Stat(marker); os.IsNotExist(err) {
+				os.WriteFile(marker, nil, 0644)
+				os.Exit(3)
+			}
+		}
+		Log(os.Stdout, "trace", "handled")
+		return emit(n * 2)
+	})
+	if err != nil {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func helperConfig(mode string, extra string) string {
+	return `
+    config:
+      command: ` + os.Args[0] + `
+      args: [ "-test.run=TestHelperProcess" ]
+      env:
+        GPIPE_PROCESS_HELPER: ` + mode + extra
+}
+
+func TestFrame(t *testing.T) {
+	buf := &bytes.Buffer{}
+	assert.NoError(t, WriteFrame(buf, &Frame{Type: FrameMessage, Data: json.RawMessage(`{"a":1}`)}))
+	assert.Equal(t, []byte{0, 0, 0, 33}, buf.Bytes()[:4])
+	frame, err := ReadFrame(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, &Frame{Type: FrameMessage, Data: json.RawMessage(`{"a":1}`)}, frame)
+
+	_, err = ReadFrame(bytes.NewReader([]byte{0xff, 0, 0, 0}))
+	assert.ErrorContains(t, err, "exceeds")
+	_, err = ReadFrame(bytes.NewReader([]byte{0, 0, 0, 10, '{'}))
+	assert.Error(t, err)
+}
+
+func TestProcess(t *testing.T) {
+	genName, sinkName := uuid.NewString(), uuid.NewString()
+	recv := make(chan int, 100)
+	assert.NoError(t, gpipe.RegisterModule(gpipe.NewSimpleModule(genName, func(name string, config interface{}) (gpipe.ModuleInstance, error) {
+		return gpipe.NewSimpleModuleInstance(genName, name, func(ctx context.Context, modCtx gpipe.ModuleContext) error {
+			for i := 1; i <= 5; i++ {
+				modCtx.Collect(i)
+			}
+			// 子进程重启后继续发送, 直到停止
+			for {
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-time.After(20 * time.Millisecond):
+					modCtx.Collect(100)
+				}
+			}
+		}), nil
+	})))
+	assert.NoError(t, gpipe.RegisterModule(gpipe.NewSimpleModule(sinkName, func(name string, config interface{}) (gpipe.ModuleInstance, error) {
+		return gpipe.NewSimpleModuleInstance(sinkName, name, func(ctx context.Context, modCtx gpipe.ModuleContext) error {
+			for {
+				select {
+				case <-ctx.Done():
+					return nil
+				case v := <-modCtx.MessageQueue():
+					n := 0
+					json.Unmarshal(v.([]byte), &n)
+					recv <- n
+				}
+			}
+		}), nil
+	})))
+
+	eng := gpipe.NewEngine(gpipe.EngineWithLogLevel(gpipe.LogLevelError))
+	assert.NoError(t, eng.Run(context.Background(), strings.NewReader(`
+engine:
+  Gen:
+    module: `+genName+`
+    parent: [ ]
+  Double:
+    module: exec/process
+    parent: [ Gen ]`+helperConfig("crash", `
+        GPIPE_PROCESS_MARKER: `+filepath.Join(t.TempDir(), "crashed")+`
+      restartDelayMs: 10`)+`
+  Sink:
+    module: `+sinkName+`
+    parent: [ Double ]
+`)))
+	next := func() int {
+		select {
+		case n := <-recv:
+			return n
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for process output")
+			return 0
+		}
+	}
+	for _, expect := range []int{2, 4, 6, 8} {
+		assert.Equal(t, expect, next())
+	}
+	// 5 以及子进程退出时还在管道中的消息丢失, 重启后恢复处理
+	for n := next(); n != 200; n = next() {
+	}
+	stats := eng.Stats()
+	eng.Stop()
+	assert.Equal(t, uint64(0), stats[1].Errors)
+}
+
+func TestProcess_MaxRestarts(t *testing.T) {
+	eng := gpipe.NewEngine(gpipe.EngineWithLogLevel(gpipe.LogLevelError))
+	events := eng.Events(context.Background())
+	assert.NoError(t, eng.Run(context.Background(), strings.NewReader(`
+engine:
+  Exit:
+    module: exec/process
+    parent: [ ]`+helperConfig("exit", `
+      maxRestarts: 1
+      restartDelayMs: 10`)+`
+`)))
+	defer eng.Stop()
+	for {
+		select {
+		case ev := <-events:
+			if ev.Type == gpipe.EventParallelExited {
+				assert.ErrorContains(t, ev.Err, "exited after 1 restarts")
+				return
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("process not exited")
+		}
+	}
+}
+
+func TestProcess_RestartDelayClock(t *testing.T) {
+	inst, err := NewProcessModule().New("Exit", map[string]interface{}{
+		"command":        os.Args[0],
+		"args":           []interface{}{"-test.run=TestHelperProcess"},
+		"env":            map[string]interface{}{"GPIPE_PROCESS_HELPER": "exit"},
+		"restartDelayMs": 60000,
+		"maxRestarts":    2,
+	})
+	assert.NoError(t, err)
+	// 重启等待使用模块的 Clock, 由 FakeClock 推进而不是真的等待一分钟
+	clock := gpipetest.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	h := gpipetest.Start(t, inst, gpipetest.WithClock(clock))
+	for i := 0; i < 2; i++ {
+		clock.BlockUntil(1)
+		clock.Advance(time.Minute)
+	}
+	select {
+	case <-h.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("process not exited")
+	}
+	assert.ErrorContains(t, h.Stop(), "exited after 2 restarts")
+	h.AssertLogged(gpipe.LogLevelError, "restarting in 60000ms")
+}
+
+func TestProcess_MalformedFrame(t *testing.T) {
+	eng := gpipe.NewEngine(gpipe.EngineWithLogLevel(gpipe.LogLevelError))
+	events := eng.Events(context.Background())
+	assert.NoError(t, eng.Run(context.Background(), strings.NewReader(`
+engine:
+  Malformed:
+    module: exec/process
+    parent: [ ]`+helperConfig("malformed", `
+      maxRestarts: 0`)+`
+`)))
+	defer eng.Stop()
+	for {
+		select {
+		case ev := <-events:
+			if ev.Type == gpipe.EventParallelExited {
+				assert.ErrorContains(t, ev.Err, "exited after 0 restarts")
+				assert.ErrorContains(t, ev.Err, "unexpected end of JSON input")
+				return
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("process not killed after malformed frame")
+		}
+	}
+}
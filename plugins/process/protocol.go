@@ -0,0 +1,105 @@
+package process
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MaxFrameSize 单个 frame 的最大长度, 超过时视为协议错误
+const MaxFrameSize = 16 << 20
+
+type FrameType string
+
+const (
+	FrameMessage FrameType = "message" // 双向: 一条消息, 内容在 Data 中
+	FrameLog     FrameType = "log"     // 子进程 -> 引擎: 通过节点的 Logger 输出 Message
+)
+
+// Frame 引擎与子进程之间交换的数据, 以 4 字节大端长度 + JSON 的形式写在 stdin / stdout 上
+type Frame struct {
+	Type    FrameType       `json:"type"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	Level   string          `json:"level,omitempty"` // log 的级别: trace / info / warn / error
+	Message string          `json:"message,omitempty"`
+}
+
+func WriteFrame(w io.Writer, frame *Frame) error {
+	payload, err := json.Marshal(frame)
+	if err != nil {
+		return err
+	} else if len(payload) > MaxFrameSize {
+		return fmt.Errorf("frame size %d exceeds %d", len(payload), MaxFrameSize)
+	}
+	header := make([]byte, 4)
+	binary.BigEndian.PutUint32(header, uint32(len(payload)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err = w.Write(payload)
+	return err
+}
+
+// ReadFrame 读取一个 frame, 对端正常关闭时返回 io.EOF
+func ReadFrame(r io.Reader) (*Frame, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(header)
+	if size > MaxFrameSize {
+		return nil, fmt.Errorf("frame size %d exceeds %d", size, MaxFrameSize)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	frame := &Frame{}
+	if err := json.Unmarshal(payload, frame); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+// Handler 处理一条消息, 通过 emit 向下游发送任意条消息
+type Handler func(data json.RawMessage, emit func(v interface{}) error) error
+
+// Serve 子进程侧的参考实现: 从 r (通常为 stdin) 读取消息并交给 handler, handler 发送的消息写到 w (通常为 stdout)
+// r 关闭时返回 nil, 引擎以此通知子进程退出
+func Serve(r io.Reader, w io.Writer, handler Handler) error {
+	reader, writer := bufio.NewReader(r), bufio.NewWriter(w)
+	emit := func(v interface{}) error {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		} else if err := WriteFrame(writer, &Frame{Type: FrameMessage, Data: data}); err != nil {
+			return err
+		}
+		return writer.Flush()
+	}
+	for {
+		frame, err := ReadFrame(reader)
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if frame.Type != FrameMessage {
+			continue
+		}
+		if err := handler(frame.Data, emit); err != nil {
+			return err
+		}
+	}
+}
+
+// Log 子进程通过引擎的 Logger 输出日志
+func Log(w io.Writer, level, message string) error {
+	return WriteFrame(w, &Frame{Type: FrameLog, Level: level, Message: message})
+}
@@ -0,0 +1,181 @@
+package script
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/nosuchperson/gpipe"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"sort"
+)
+
+// messageToStarlark 将输入转换为脚本中的 msg, 包含 payload 与 headers 两个字段
+func messageToStarlark(msg *gpipe.Message) (starlark.Value, error) {
+	payload, err := toStarlark(msg.Payload)
+	if err != nil {
+		return nil, err
+	}
+	headers := starlark.NewDict(len(msg.Headers))
+	for k, v := range msg.Headers {
+		headers.SetKey(starlark.String(k), starlark.String(v))
+	}
+	return starlarkstruct.FromStringDict(messageConstructor, starlark.StringDict{
+		"payload": payload,
+		"headers": headers,
+	}), nil
+}
+
+// messageFromStarlark 将 message() 创建的值转换为 *gpipe.Message
+func messageFromStarlark(s *starlarkstruct.Struct) (*gpipe.Message, error) {
+	payload, err := s.Attr("payload")
+	if err != nil {
+		return nil, err
+	}
+	msg := &gpipe.Message{Headers: map[string]string{}}
+	if msg.Payload, err = fromStarlark(payload); err != nil {
+		return nil, err
+	}
+	headers, err := s.Attr("headers")
+	if err != nil {
+		return nil, err
+	}
+	dict, ok := headers.(*starlark.Dict)
+	if !ok {
+		return nil, fmt.Errorf("headers must be dict, got %s", headers.Type())
+	}
+	for _, item := range dict.Items() {
+		k, ok1 := starlark.AsString(item[0])
+		v, ok2 := starlark.AsString(item[1])
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("headers must be dict of string, got %s: %s", item[0].Type(), item[1].Type())
+		}
+		msg.Headers[k] = v
+	}
+	return msg, nil
+}
+
+// toStarlark 将 Go 的值转换为 Starlark 的值, 其他类型先编码为 JSON 再转换
+func toStarlark(v interface{}) (starlark.Value, error) {
+	switch v := v.(type) {
+	case nil:
+		return starlark.None, nil
+	case starlark.Value:
+		return v, nil
+	case bool:
+		return starlark.Bool(v), nil
+	case string:
+		return starlark.String(v), nil
+	case []byte:
+		return starlark.Bytes(v), nil
+	case int:
+		return starlark.MakeInt(v), nil
+	case int32:
+		return starlark.MakeInt64(int64(v)), nil
+	case int64:
+		return starlark.MakeInt64(v), nil
+	case uint64:
+		return starlark.MakeUint64(v), nil
+	case float32:
+		return starlark.Float(v), nil
+	case float64:
+		return starlark.Float(v), nil
+	case []interface{}:
+		list := make([]starlark.Value, 0, len(v))
+		for _, item := range v {
+			value, err := toStarlark(item)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		return starlark.NewList(list), nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		dict := starlark.NewDict(len(v))
+		for _, k := range keys {
+			value, err := toStarlark(v[k])
+			if err != nil {
+				return nil, err
+			}
+			dict.SetKey(starlark.String(k), value)
+		}
+		return dict, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return nil, err
+	}
+	return toStarlark(generic)
+}
+
+// fromStarlark 将 Starlark 的值转换为 Go 的值, dict 的 key 必须为字符串
+func fromStarlark(v starlark.Value) (interface{}, error) {
+	switch v := v.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case starlark.Bool:
+		return bool(v), nil
+	case starlark.String:
+		return string(v), nil
+	case starlark.Bytes:
+		return []byte(v), nil
+	case starlark.Int:
+		if i, ok := v.Int64(); ok {
+			return int(i), nil
+		}
+		return nil, fmt.Errorf("int %s out of range", v)
+	case starlark.Float:
+		return float64(v), nil
+	case *starlark.List:
+		return fromStarlarkIterable(v)
+	case starlark.Tuple:
+		return fromStarlarkIterable(v)
+	case *starlark.Dict:
+		ret := make(map[string]interface{}, v.Len())
+		for _, item := range v.Items() {
+			k, ok := starlark.AsString(item[0])
+			if !ok {
+				return nil, fmt.Errorf("dict key must be string, got %s", item[0].Type())
+			}
+			value, err := fromStarlark(item[1])
+			if err != nil {
+				return nil, err
+			}
+			ret[k] = value
+		}
+		return ret, nil
+	case *starlarkstruct.Struct:
+		dict := starlark.StringDict{}
+		v.ToStringDict(dict)
+		ret := make(map[string]interface{}, len(dict))
+		for k, item := range dict {
+			value, err := fromStarlark(item)
+			if err != nil {
+				return nil, err
+			}
+			ret[k] = value
+		}
+		return ret, nil
+	}
+	return nil, fmt.Errorf("unsupported type %s", v.Type())
+}
+
+func fromStarlarkIterable(v starlark.Indexable) ([]interface{}, error) {
+	ret := make([]interface{}, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		value, err := fromStarlark(v.Index(i))
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, value)
+	}
+	return ret, nil
+}
@@ -0,0 +1,226 @@
+package script
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/nosuchperson/gpipe"
+	"go.starlark.net/lib/json"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"os"
+)
+
+const (
+	moduleName = "script/transform"
+	// modCtxKey 保存在 starlark.Thread 中的 ModuleContext, 供 emit 使用
+	modCtxKey = "gpipe.modCtx"
+	// inputKey 保存在 starlark.Thread 中的当前输入, 输出时沿用其 header
+	inputKey = "gpipe.input"
+)
+
+// messageConstructor 由 message() 创建的 struct 的构造器, 用于区分脚本中普通的 struct
+var messageConstructor = starlark.String("message")
+
+type scriptConfig struct {
+	Script   string `yaml:"script" doc:"内联的 Starlark 脚本, 与 file 二选一"`
+	File     string `yaml:"file" doc:"Starlark 脚本文件"`
+	Function string `yaml:"function" default:"transform" doc:"处理每条消息的函数, 参数为 msg"`
+	MaxSteps uint64 `yaml:"maxSteps" doc:"每条消息最多执行的步数, 超过后中止, 0 为不限制"`
+}
+
+type scriptModule struct {
+	name     string
+	config   *scriptConfig
+	function starlark.Callable
+}
+
+func init() {
+	gpipe.RegisterModule(NewScriptModule())
+}
+
+func NewScriptModule() gpipe.ModuleFactory {
+	return gpipe.NewSimpleModule(moduleName, func(name string, config interface{}) (gpipe.ModuleInstance, error) {
+		configMap, err := gpipe.ConfigMapUnmarshal(config, &scriptConfig{Function: "transform"})
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid configuration, err = %v", moduleName, err)
+		}
+		function, err := compile(name, configMap)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", moduleName, err)
+		}
+		return &scriptModule{name: name, config: configMap, function: function}, nil
+	}, gpipe.SimpleModuleWithConfigSchema(&scriptConfig{}), gpipe.SimpleModuleWithInfo(gpipe.ModuleMetadata{
+		Description: "使用 Starlark 脚本处理每条消息, 可以过滤、修改消息或输出多条消息",
+		Version:     "1.0.0",
+		Input:       "any, *gpipe.Message 的 header 可在脚本中访问",
+		Output:      "any, 带有 header 时为 *gpipe.Message",
+	}))
+}
+
+// predeclared 脚本中可以直接使用的内置对象
+var predeclared = starlark.StringDict{
+	"json":    json.Module,
+	"struct":  starlark.NewBuiltin("struct", starlarkstruct.Make),
+	"message": starlark.NewBuiltin("message", newMessage),
+	"emit":    starlark.NewBuiltin("emit", emit),
+}
+
+// compile 编译脚本并执行顶层语句, 返回处理函数; 顶层的全局变量被冻结, 各 parallel 共享只读
+func compile(name string, config *scriptConfig) (starlark.Callable, error) {
+	filename, src := config.File, interface{}(config.Script)
+	if config.Script != "" && config.File != "" {
+		return nil, errors.New("only one of script and file can be set")
+	} else if config.File != "" {
+		data, err := os.ReadFile(config.File)
+		if err != nil {
+			return nil, err
+		}
+		src = data
+	} else if config.Script != "" {
+		filename = name + ".star"
+	} else {
+		return nil, errors.New("script or file is required")
+	}
+	_, program, err := starlark.SourceProgram(filename, src, predeclared.Has)
+	if err != nil {
+		return nil, err
+	}
+	globals, err := program.Init(&starlark.Thread{Name: name}, predeclared)
+	if err != nil {
+		return nil, evalError(err)
+	}
+	globals.Freeze()
+	function, ok := globals[config.Function].(starlark.Callable)
+	if !ok {
+		return nil, fmt.Errorf("%s: function %s is not defined", filename, config.Function)
+	}
+	return function, nil
+}
+
+func (s *scriptModule) Core(ctx context.Context, modCtx gpipe.ModuleContext) error {
+	for {
+		select {
+		case _ = <-ctx.Done():
+			return nil
+		case msg := <-modCtx.MessageQueue():
+			s.process(ctx, modCtx, msg)
+		}
+	}
+}
+
+// newThread 每条消息使用独立的 thread, 步数限制与停止时的取消互不影响
+func (s *scriptModule) newThread(modCtx gpipe.ModuleContext, input *gpipe.Message) *starlark.Thread {
+	thread := &starlark.Thread{
+		Name: s.name,
+		Print: func(_ *starlark.Thread, msg string) {
+			modCtx.Logger().Info(modCtx, "%s", msg)
+		},
+	}
+	thread.SetLocal(modCtxKey, modCtx)
+	thread.SetLocal(inputKey, input)
+	if s.config.MaxSteps > 0 {
+		thread.SetMaxExecutionSteps(s.config.MaxSteps)
+	}
+	return thread
+}
+
+// process 调用处理函数, 返回 None 时丢弃消息, 返回 list 时逐个输出, 其他值作为一条消息输出
+// 脚本出错时记录带行号的错误并丢弃该消息
+func (s *scriptModule) process(ctx context.Context, modCtx gpipe.ModuleContext, msg interface{}) {
+	if ctx.Err() != nil {
+		return
+	}
+	input := gpipe.AsMessage(msg)
+	value, err := messageToStarlark(input)
+	if err != nil {
+		modCtx.Logger().Error(modCtx, "converting input data failed due to %v", err)
+		return
+	}
+	thread := s.newThread(modCtx, input)
+	// 停止时中断正在执行的脚本
+	stop := context.AfterFunc(ctx, func() {
+		thread.Cancel("stopped")
+	})
+	ret, err := starlark.Call(thread, s.function, starlark.Tuple{value}, nil)
+	stop()
+	if ctx.Err() != nil {
+		return
+	} else if err != nil {
+		modCtx.Logger().Error(modCtx, "%v", evalError(err))
+		return
+	}
+	outputs := []starlark.Value{ret}
+	if list, ok := ret.(*starlark.List); ok {
+		outputs = outputs[:0]
+		for i := 0; i < list.Len(); i++ {
+			outputs = append(outputs, list.Index(i))
+		}
+	}
+	for _, output := range outputs {
+		if output == starlark.None {
+			continue
+		}
+		if v, err := toOutput(thread, output); err != nil {
+			modCtx.Logger().Error(modCtx, "%s returned invalid value: %v", s.config.Function, err)
+		} else {
+			modCtx.Collect(v)
+		}
+	}
+}
+
+// emit(value) 立即向下游输出一条消息
+func emit(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var value starlark.Value
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &value); err != nil {
+		return nil, err
+	}
+	modCtx, ok := thread.Local(modCtxKey).(gpipe.ModuleContext)
+	if !ok {
+		return nil, fmt.Errorf("%s: can only be called while processing a message", fn.Name())
+	}
+	v, err := toOutput(thread, value)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn.Name(), err)
+	}
+	modCtx.Collect(v)
+	return starlark.None, nil
+}
+
+// message(payload, headers={}) 创建带有 header 的消息
+func newMessage(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var payload starlark.Value
+	headers := starlark.NewDict(0)
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "payload", &payload, "headers?", &headers); err != nil {
+		return nil, err
+	}
+	return starlarkstruct.FromStringDict(messageConstructor, starlark.StringDict{
+		"payload": payload,
+		"headers": headers,
+	}), nil
+}
+
+// toOutput 将脚本的返回值转换为下游消息
+// message() 创建的值转换为 *gpipe.Message; 其他值在输入带有 header 时沿用输入的 header
+func toOutput(thread *starlark.Thread, value starlark.Value) (interface{}, error) {
+	if s, ok := value.(*starlarkstruct.Struct); ok && s.Constructor() == messageConstructor {
+		return messageFromStarlark(s)
+	}
+	payload, err := fromStarlark(value)
+	if err != nil {
+		return nil, err
+	}
+	if input, ok := thread.Local(inputKey).(*gpipe.Message); ok && len(input.Headers) > 0 {
+		return input.WithPayload(payload), nil
+	}
+	return payload, nil
+}
+
+// evalError 脚本运行时错误带上调用栈, 其中包含出错的行号
+func evalError(err error) error {
+	var evalErr *starlark.EvalError
+	if errors.As(err, &evalErr) {
+		return errors.New(evalErr.Backtrace())
+	}
+	return err
+}
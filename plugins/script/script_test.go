@@ -0,0 +1,153 @@
+package script
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/nosuchperson/gpipe"
+	"github.com/nosuchperson/gpipe/gpipetest"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScriptTransform(t *testing.T) {
+	genName, sinkName := uuid.NewString(), uuid.NewString()
+	recv := make(chan interface{}, 100)
+	assert.NoError(t, gpipe.RegisterModule(gpipe.NewSimpleModule(genName, func(name string, config interface{}) (gpipe.ModuleInstance, error) {
+		return gpipe.NewSimpleModuleInstance(genName, name, func(ctx context.Context, modCtx gpipe.ModuleContext) error {
+			modCtx.Collect(&gpipe.Message{Headers: map[string]string{"src": "gen"}, Payload: 1})
+			modCtx.Collect(2)
+			modCtx.Collect(3)
+			modCtx.Collect(&gpipe.Message{Headers: map[string]string{"k": "v"}, Payload: 5})
+			modCtx.Collect(map[string]interface{}{"name": "seven", "value": 7})
+			<-ctx.Done()
+			return nil
+		}), nil
+	})))
+	assert.NoError(t, gpipe.RegisterModule(gpipe.NewSimpleModule(sinkName, func(name string, config interface{}) (gpipe.ModuleInstance, error) {
+		return gpipe.NewSimpleModuleInstance(sinkName, name, func(ctx context.Context, modCtx gpipe.ModuleContext) error {
+			for {
+				select {
+				case <-ctx.Done():
+					return nil
+				case v := <-modCtx.MessageQueue():
+					recv <- v
+				}
+			}
+		}), nil
+	})))
+
+	eng := gpipe.NewEngine(gpipe.EngineWithLogLevel(gpipe.LogLevelError))
+	assert.NoError(t, eng.Run(context.Background(), strings.NewReader(`
+engine:
+  Gen:
+    module: `+genName+`
+    parent: [ ]
+  Script:
+    module: script/transform
+    parent: [ Gen ]
+    config:
+      script: |
+        def transform(msg):
+            if type(msg.payload) == "dict":
+                emit(json.encode(msg.payload))
+                return None
+            if msg.payload % 2 == 0:
+                return None
+            if msg.payload == 5:
+                return [msg.payload, msg.payload * 10]
+            return message(msg.payload, headers = {"src": msg.headers.get("src", "none")})
+  Sink:
+    module: `+sinkName+`
+    parent: [ Script ]
+`)))
+	defer eng.Stop()
+	expects := []interface{}{
+		&gpipe.Message{Headers: map[string]string{"src": "gen"}, Payload: 1},
+		&gpipe.Message{Headers: map[string]string{"src": "none"}, Payload: 3},
+		&gpipe.Message{Headers: map[string]string{"k": "v"}, Payload: 5},
+		&gpipe.Message{Headers: map[string]string{"k": "v"}, Payload: 50},
+		`{"name":"seven","value":7}`,
+	}
+	for _, expect := range expects {
+		select {
+		case v := <-recv:
+			assert.Equal(t, expect, v)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout")
+		}
+	}
+}
+
+func TestScriptTransform_Errors(t *testing.T) {
+	mod := NewScriptModule()
+	_, err := mod.New("Script", map[string]interface{}{"script": "x = 1\ny = )\n"})
+	assert.ErrorContains(t, err, "Script.star:2:")
+	_, err = mod.New("Script", map[string]interface{}{"script": "x = 1\nfail('boom')\n"})
+	assert.ErrorContains(t, err, "Script.star:2:")
+	assert.ErrorContains(t, err, "boom")
+	_, err = mod.New("Script", map[string]interface{}{"script": "def other(msg):\n    return msg\n"})
+	assert.ErrorContains(t, err, "function transform is not defined")
+	_, err = mod.New("Script", map[string]interface{}{})
+	assert.ErrorContains(t, err, "script or file is required")
+}
+
+func TestConvert(t *testing.T) {
+	for _, v := range []interface{}{nil, true, "s", []byte("b"), 1, 1.5,
+		[]interface{}{1, "a"}, map[string]interface{}{"a": []interface{}{1.5}}} {
+		value, err := toStarlark(v)
+		assert.NoError(t, err)
+		ret, err := fromStarlark(value)
+		assert.NoError(t, err)
+		assert.Equal(t, v, ret)
+	}
+	// 其他类型经过 JSON 转换
+	value, err := toStarlark(struct {
+		A int `json:"a"`
+	}{A: 1})
+	assert.NoError(t, err)
+	ret, err := fromStarlark(value)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"a": 1.0}, ret)
+}
+
+func TestScriptTransform_RuntimeError(t *testing.T) {
+	inst, err := NewScriptModule().New("Script", map[string]interface{}{
+		"script":   "def transform(msg):\n    return 10 // msg.payload\n",
+		"maxSteps": 1000,
+	})
+	assert.NoError(t, err)
+	h := gpipetest.Start(t, inst)
+	h.Feed(5, 0, 2)
+	h.AssertOutputs(2, 5)
+	h.AssertLogged(gpipe.LogLevelError, "Script.star:2:15")
+	h.AssertLogged(gpipe.LogLevelError, "division by zero")
+	assert.NoError(t, h.Stop())
+
+	inst, err = NewScriptModule().New("Script", map[string]interface{}{
+		"script":   "def transform(msg):\n    for i in range(msg.payload):\n        pass\n    return msg.payload\n",
+		"maxSteps": 100,
+	})
+	assert.NoError(t, err)
+	h = gpipetest.Start(t, inst)
+	// 超出步数的消息被丢弃, 不影响后续消息
+	h.Feed(1000, 1)
+	h.AssertOutputs(1)
+	h.AssertLogged(gpipe.LogLevelError, "too many steps")
+	assert.NoError(t, h.Stop())
+}
+
+func TestScriptTransform_Stop(t *testing.T) {
+	inst, err := NewScriptModule().New("Script", map[string]interface{}{
+		"script":   "def transform(msg):\n    print(\"started\")\n    for i in range(msg.payload):\n        pass\n    return msg.payload\n",
+		"maxSteps": 1 << 50,
+	})
+	assert.NoError(t, err)
+	h := gpipetest.Start(t, inst)
+	h.Feed(1 << 40)
+	assert.Eventually(t, func() bool { return h.Context().Logged(gpipe.LogLevelInfo, "started") }, 5*time.Second, time.Millisecond)
+	// 设置了 maxSteps 时停止同样会中断正在执行的脚本
+	assert.NoError(t, h.Stop())
+	assert.Empty(t, h.Context().Outputs())
+}
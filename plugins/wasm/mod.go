@@ -0,0 +1,229 @@
+package wasm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/nosuchperson/gpipe"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	moduleName = "wasm/transform"
+	// hostModuleName 提供给 wasm 的 host 函数所在的模块名
+	hostModuleName = "gpipe"
+)
+
+type wasmConfig struct {
+	Path           string `yaml:"path" doc:"wasm 文件路径"`
+	Function       string `yaml:"function" default:"transform" doc:"处理每条消息的导出函数"`
+	Alloc          string `yaml:"alloc" default:"alloc" doc:"在 wasm 内存中分配输入所用的导出函数"`
+	MaxMemoryPages uint32 `yaml:"maxMemoryPages" doc:"每个实例可使用的最大内存页数 (64KB/页), 0 为不限制"`
+}
+
+type wasmModule struct {
+	name    string
+	config  *wasmConfig
+	lock    sync.Mutex
+	runtime wazero.Runtime
+	// 当前使用的编译结果及其对应文件的修改时间, 文件变化后在 parallel 启动时重新编译
+	compiled wazero.CompiledModule
+	modTime  time.Time
+}
+
+type collectorKey struct{}
+
+func init() {
+	gpipe.RegisterModule(NewWasmModule())
+}
+
+func NewWasmModule() gpipe.ModuleFactory {
+	return gpipe.NewSimpleModule(moduleName, func(name string, config interface{}) (gpipe.ModuleInstance, error) {
+		configMap, err := gpipe.ConfigMapUnmarshal(config, &wasmConfig{Function: "transform", Alloc: "alloc"})
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid configuration, err = %v", moduleName, err)
+		} else if configMap.Path == "" {
+			return nil, fmt.Errorf("%s: path is required", moduleName)
+		} else if _, err := os.Stat(configMap.Path); err != nil {
+			return nil, fmt.Errorf("%s: %v", moduleName, err)
+		}
+		return &wasmModule{name: name, config: configMap}, nil
+	}, gpipe.SimpleModuleWithConfigSchema(&wasmConfig{}), gpipe.SimpleModuleWithInfo(gpipe.ModuleMetadata{
+		Description: "使用 wazero 运行 wasm 中导出的函数处理每条消息, 每个 parallel 使用独立的 wasm 实例",
+		Version:     "1.0.0",
+		Input:       "[]byte / string, 其他类型编码为 JSON",
+		Output:      "[]byte",
+	}))
+}
+
+// Init 创建 wasm 运行时并编译 wasm 文件
+func (w *wasmModule) Init(ctx context.Context) error {
+	runtimeConfig := wazero.NewRuntimeConfig().WithCloseOnContextDone(true)
+	if w.config.MaxMemoryPages > 0 {
+		runtimeConfig = runtimeConfig.WithMemoryLimitPages(w.config.MaxMemoryPages)
+	}
+	w.runtime = wazero.NewRuntimeWithConfig(ctx, runtimeConfig)
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, w.runtime); err != nil {
+		w.runtime.Close(ctx)
+		return err
+	}
+	_, err := w.runtime.NewHostModuleBuilder(hostModuleName).
+		NewFunctionBuilder().WithFunc(emit).Export("emit").
+		Instantiate(ctx)
+	if err == nil {
+		_, err = w.compile(ctx)
+	}
+	if err != nil {
+		w.runtime.Close(ctx)
+		return err
+	}
+	return nil
+}
+
+func (w *wasmModule) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	// 编译结果属于 runtime, 随 runtime 一起释放
+	w.compiled = nil
+	return w.runtime.Close(context.Background())
+}
+
+// compile 返回当前的编译结果, wasm 文件的修改时间变化后重新编译
+// 已经运行的实例不受影响, 通过 RestartNode / ScaleNode 重新启动的 parallel 使用新的 wasm
+func (w *wasmModule) compile(ctx context.Context) (wazero.CompiledModule, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	stat, err := os.Stat(w.config.Path)
+	if err != nil {
+		return nil, err
+	} else if w.compiled != nil && stat.ModTime().Equal(w.modTime) {
+		return w.compiled, nil
+	}
+	binary, err := os.ReadFile(w.config.Path)
+	if err != nil {
+		return nil, err
+	}
+	compiled, err := w.runtime.CompileModule(ctx, binary)
+	if err != nil {
+		return nil, fmt.Errorf("compile %s failed: %v", w.config.Path, err)
+	}
+	for _, fn := range []string{w.config.Function, w.config.Alloc} {
+		if _, ok := compiled.ExportedFunctions()[fn]; !ok {
+			compiled.Close(ctx)
+			return nil, fmt.Errorf("%s does not export function %s", w.config.Path, fn)
+		}
+	}
+	if len(compiled.ExportedMemories()) == 0 {
+		compiled.Close(ctx)
+		return nil, fmt.Errorf("%s does not export memory", w.config.Path)
+	}
+	if w.compiled != nil {
+		w.compiled.Close(ctx)
+	}
+	w.compiled, w.modTime = compiled, stat.ModTime()
+	return compiled, nil
+}
+
+// instantiate 为当前 parallel 创建独立的 wasm 实例
+func (w *wasmModule) instantiate(ctx context.Context) (api.Module, error) {
+	compiled, err := w.compile(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// 匿名实例, 允许多个 parallel 同时实例化同一个模块; 只调用 reactor 的 _initialize, 不执行 _start
+	return w.runtime.InstantiateModule(ctx, compiled, wazero.NewModuleConfig().WithName("").WithStartFunctions("_initialize"))
+}
+
+func (w *wasmModule) Core(ctx context.Context, modCtx gpipe.ModuleContext) error {
+	inst, err := w.instantiate(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { inst.Close(context.Background()) }()
+	callCtx := context.WithValue(ctx, collectorKey{}, modCtx)
+	for {
+		select {
+		case _ = <-ctx.Done():
+			return nil
+		case msg := <-modCtx.MessageQueue():
+			data, err := encodeMessage(msg)
+			if err != nil {
+				modCtx.Logger().Error(modCtx, "encoding input data failed due to %v", err)
+				continue
+			}
+			output, err := w.call(callCtx, inst, data)
+			if ctx.Err() != nil {
+				return nil
+			} else if err != nil {
+				// trap 之后实例的内存状态不可信, 重新创建实例
+				modCtx.Logger().Error(modCtx, "call %s failed: %v", w.config.Function, err)
+				inst.Close(context.Background())
+				next, err := w.instantiate(ctx)
+				if err != nil {
+					return err
+				}
+				inst = next
+				continue
+			}
+			if output != nil {
+				modCtx.Collect(output)
+			}
+		}
+	}
+}
+
+// call 将 data 写入 wasm 内存并调用处理函数
+// 处理函数的签名为 (ptr i32, len i32) -> i64, 返回值高 32 位为输出的地址, 低 32 位为长度, 返回 0 表示没有输出
+func (w *wasmModule) call(ctx context.Context, inst api.Module, data []byte) ([]byte, error) {
+	res, err := inst.ExportedFunction(w.config.Alloc).Call(ctx, uint64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	ptr := uint32(res[0])
+	if !inst.Memory().Write(ptr, data) {
+		return nil, fmt.Errorf("write %d bytes at %d out of memory range", len(data), ptr)
+	}
+	res, err = inst.ExportedFunction(w.config.Function).Call(ctx, uint64(ptr), uint64(len(data)))
+	if err != nil {
+		return nil, err
+	} else if res[0] == 0 {
+		return nil, nil
+	}
+	return readMemory(inst, uint32(res[0]>>32), uint32(res[0]))
+}
+
+// emit host 函数 gpipe.emit(ptr i32, len i32), wasm 通过它在一次调用中向下游发送多条消息
+func emit(ctx context.Context, m api.Module, ptr, length uint32) {
+	data, err := readMemory(m, ptr, length)
+	if err != nil {
+		panic(err)
+	}
+	if modCtx, ok := ctx.Value(collectorKey{}).(gpipe.ModuleContext); ok {
+		modCtx.Collect(data)
+	}
+}
+
+// readMemory 复制 wasm 内存中的数据, 实例的内存在之后的调用中会被复用
+func readMemory(m api.Module, ptr, length uint32) ([]byte, error) {
+	data, ok := m.Memory().Read(ptr, length)
+	if !ok {
+		return nil, fmt.Errorf("read %d bytes at %d out of memory range", length, ptr)
+	}
+	return append([]byte{}, data...), nil
+}
+
+// encodeMessage []byte 与 string 原样传入, 其他类型编码为 JSON
+func encodeMessage(msg interface{}) ([]byte, error) {
+	switch v := msg.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	}
+	return json.Marshal(msg)
+}
@@ -0,0 +1,145 @@
+package wasm
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/nosuchperson/gpipe"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// section 生成 wasm 的一个 section, 测试中的内容都小于 128 字节, 长度只需一个字节
+func section(id byte, content ...byte) []byte {
+	return append([]byte{id, byte(len(content))}, content...)
+}
+
+func name(s string) []byte {
+	return append([]byte{byte(len(s))}, s...)
+}
+
+// testWasm 手写的 wasm 模块, 等价于
+//
+//	(import "gpipe" "emit" (func $emit (param i32 i32)))
+//	(memory (export "memory") 1)
+//	(func (export "alloc") (param i32) (result i32) i32.const 1024)
+//	(func (export "transform") (param $p i32) (param $l i32) (result i64)
+//	  首字节为 '!' 时 unreachable, 为 'x' 时返回 0 丢弃该消息
+//	  否则先 emit 一次输入, 再将输入作为返回值, 即每条消息输出两次)
+func testWasm() []byte {
+	var bin []byte
+	bin = append(bin, 0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00)
+	bin = append(bin, section(0x01, 0x03,
+		0x60, 0x02, 0x7f, 0x7f, 0x00, // (i32, i32) -> ()
+		0x60, 0x01, 0x7f, 0x01, 0x7f, // (i32) -> i32
+		0x60, 0x02, 0x7f, 0x7f, 0x01, 0x7e, // (i32, i32) -> i64
+	)...)
+	imports := []byte{0x01}
+	imports = append(imports, name("gpipe")...)
+	imports = append(imports, name("emit")...)
+	bin = append(bin, section(0x02, append(imports, 0x00, 0x00)...)...)
+	bin = append(bin, section(0x03, 0x02, 0x01, 0x02)...)
+	bin = append(bin, section(0x05, 0x01, 0x00, 0x01)...)
+	exports := []byte{0x03}
+	exports = append(append(exports, name("memory")...), 0x02, 0x00)
+	exports = append(append(exports, name("alloc")...), 0x00, 0x01)
+	exports = append(append(exports, name("transform")...), 0x00, 0x02)
+	bin = append(bin, section(0x07, exports...)...)
+	alloc := []byte{0x00, 0x41, 0x80, 0x08, 0x0b}
+	transform := []byte{0x00,
+		0x20, 0x00, 0x2d, 0x00, 0x00, 0x41, 0x21, 0x46, 0x04, 0x40, 0x00, 0x0b, // if p[0] == '!' { unreachable }
+		0x20, 0x00, 0x2d, 0x00, 0x00, 0x41, 0xf8, 0x00, 0x46, 0x04, 0x40, 0x42, 0x00, 0x0f, 0x0b, // if p[0] == 'x' { return 0 }
+		0x20, 0x00, 0x20, 0x01, 0x10, 0x00, // emit(p, l)
+		0x20, 0x00, 0xad, 0x42, 0x20, 0x86, 0x20, 0x01, 0xad, 0x84, // p << 32 | l
+		0x0b,
+	}
+	code := []byte{0x02, byte(len(alloc))}
+	code = append(code, alloc...)
+	code = append(code, byte(len(transform)))
+	code = append(code, transform...)
+	return append(bin, section(0x0a, code...)...)
+}
+
+func TestWasmTransform(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "transform.wasm")
+	assert.NoError(t, os.WriteFile(path, testWasm(), 0644))
+
+	genName, sinkName := uuid.NewString(), uuid.NewString()
+	recv := make(chan string, 100)
+	assert.NoError(t, gpipe.RegisterModule(gpipe.NewSimpleModule(genName, func(name string, config interface{}) (gpipe.ModuleInstance, error) {
+		return gpipe.NewSimpleModuleInstance(genName, name, func(ctx context.Context, modCtx gpipe.ModuleContext) error {
+			for _, msg := range []string{"a", "xb", "!c", "d"} {
+				modCtx.Collect(msg)
+			}
+			<-ctx.Done()
+			return nil
+		}), nil
+	})))
+	assert.NoError(t, gpipe.RegisterModule(gpipe.NewSimpleModule(sinkName, func(name string, config interface{}) (gpipe.ModuleInstance, error) {
+		return gpipe.NewSimpleModuleInstance(sinkName, name, func(ctx context.Context, modCtx gpipe.ModuleContext) error {
+			for {
+				select {
+				case <-ctx.Done():
+					return nil
+				case v := <-modCtx.MessageQueue():
+					recv <- string(v.([]byte))
+				}
+			}
+		}), nil
+	})))
+
+	eng := gpipe.NewEngine(gpipe.EngineWithLogLevel(gpipe.LogLevelError))
+	assert.NoError(t, eng.Run(context.Background(), strings.NewReader(`
+engine:
+  Gen:
+    module: `+genName+`
+    parent: [ ]
+  Transform:
+    module: wasm/transform
+    parent: [ Gen ]
+    parallels: 2
+    config:
+      path: `+path+`
+  Sink:
+    module: `+sinkName+`
+    parent: [ Transform ]
+`)))
+	defer eng.Stop()
+	// 'x' 开头的消息被丢弃, '!' 开头的消息 trap 后实例被重建, 后续消息正常处理
+	got := []string{}
+	for len(got) < 4 {
+		select {
+		case v := <-recv:
+			got = append(got, v)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout, got %v", got)
+		}
+	}
+	sort.Strings(got)
+	assert.Equal(t, []string{"a", "a", "d", "d"}, got)
+}
+
+func TestWasmTransform_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "invalid.wasm")
+	assert.NoError(t, os.WriteFile(path, []byte("not wasm"), 0644))
+
+	_, err := NewWasmModule().New("Transform", map[string]interface{}{"path": filepath.Join(dir, "missing.wasm")})
+	assert.Error(t, err)
+
+	eng := gpipe.NewEngine(gpipe.EngineWithLogLevel(gpipe.LogLevelError))
+	err = eng.Run(context.Background(), strings.NewReader(`
+engine:
+  Transform:
+    module: wasm/transform
+    parent: [ ]
+    config:
+      path: `+path+`
+      function: map
+`))
+	assert.ErrorContains(t, err, "compile")
+}
@@ -0,0 +1,93 @@
+package gpipe
+
+import (
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// envelope 在队列中的状态
+const (
+	envWaiting int32 = iota // 未占用队列位置, 发送方等待
+	envSlot                 // 占用了队列位置
+	envTaken                // 未占用位置时已被 Core 取走
+)
+
+// enqueue 将消息放入节点队列, 队列已满时阻塞直到队列出现空位或该消息被 Core 取走, ctx 结束时返回 false
+// 队列的容量由 slots 限制, pump 取出但 Core 还未取走的消息同样占用位置
+func (m *moduleContext) enqueue(from *moduleContext, v interface{}, spanCtx trace.SpanContext) bool {
+	env := &envelope{value: v, enqueuedAt: time.Now(), spanCtx: spanCtx}
+	select {
+	case m.slots <- struct{}{}:
+		env.state.Store(envSlot)
+	default:
+		env.taken = make(chan struct{})
+	}
+	select {
+	case m.input <- env:
+	case _ = <-from.ctx.Done():
+		if env.taken == nil {
+			<-m.slots
+		}
+		return false
+	}
+	if env.taken == nil {
+		return true
+	}
+	select {
+	case _ = <-env.taken:
+		return true
+	case m.slots <- struct{}{}:
+		if !env.state.CompareAndSwap(envWaiting, envSlot) {
+			// 拿到位置之前消息已经被取走
+			<-m.slots
+		}
+		return true
+	case _ = <-from.ctx.Done():
+		return false
+	}
+}
+
+// release 消息被 Core 取走后释放其占用的队列位置, 或通知等待中的发送方
+func (m *moduleContext) release(env *envelope) {
+	if env.state.CompareAndSwap(envWaiting, envTaken) {
+		close(env.taken)
+		return
+	}
+	<-m.slots
+}
+
+// requeue 将 pump 已取出但未交给 Core 的消息放回队列头部
+func (m *moduleContext) requeue(env *envelope) {
+	m.ctrlLock.Lock()
+	defer m.ctrlLock.Unlock()
+	m.requeued = append(m.requeued, env)
+	if m.requeueCh != nil {
+		close(m.requeueCh)
+		m.requeueCh = nil
+	}
+}
+
+// popRequeued 取出最早放回的消息, 没有时返回有消息放回时关闭的 channel
+func (m *moduleContext) popRequeued() (*envelope, <-chan struct{}) {
+	m.ctrlLock.Lock()
+	defer m.ctrlLock.Unlock()
+	if len(m.requeued) > 0 {
+		env := m.requeued[0]
+		m.requeued = m.requeued[1:]
+		return env, nil
+	}
+	if m.requeueCh == nil {
+		m.requeueCh = make(chan struct{})
+	}
+	return nil, m.requeueCh
+}
+
+func (m *moduleContext) queueCap() int {
+	return cap(m.slots)
+}
+
+// queueLen 占用队列位置、还未被 Core 取走的消息数量
+func (m *moduleContext) queueLen() int {
+	return len(m.slots)
+}
@@ -0,0 +1,167 @@
+package gpipe
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ModuleConfigSchema ModuleFactory 可选实现的接口, 返回模块配置对应的结构体原型 (例如 &intervalConfig{})
+// 实现后 Config.Valid 会在启动前按照 yaml tag 校验各节点的 config, 未知的字段以及类型错误都会报错
+type ModuleConfigSchema interface {
+	ConfigSchema() interface{}
+}
+
+var yamlLinePrefix = regexp.MustCompile(`^line \d+: `)
+
+// hasInvalidModuleConfig 使用模块声明的 schema 校验所有节点的 config, 一次性返回全部错误
+// 未注册的模块在这里跳过, 由 Run 时报错
+func (cfg *Config) hasInvalidModuleConfig() error {
+	errs := []error{}
+	for _, name := range cfg.sortedNames() {
+		nodeCfg := cfg.Engine[name]
+		mod, err := nodeCfg.moduleFactory(cfg.getRegistry())
+		if err != nil {
+			continue
+		}
+		withSchema, ok := mod.(ModuleConfigSchema)
+		if !ok || withSchema.ConfigSchema() == nil {
+			continue
+		}
+		for _, msg := range validateConfigSchema(nodeCfg.Config, withSchema.ConfigSchema()) {
+			errs = append(errs, nodeCfg.errorf("worker %s config: %s", name, msg))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validateConfigSchema 返回 config 相对于 schema 的所有错误
+func validateConfigSchema(config interface{}, schema interface{}) []string {
+	if config == nil {
+		return nil
+	}
+	t := reflect.TypeOf(schema)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	msgs := unknownConfigFields("", config, t)
+	if data, err := yaml.Marshal(config); err != nil {
+		msgs = append(msgs, err.Error())
+	} else if err := yaml.Unmarshal(data, reflect.New(t).Interface()); err != nil {
+		// 重新序列化后的行号没有意义, 去掉
+		var typeErr *yaml.TypeError
+		if errors.As(err, &typeErr) {
+			for _, msg := range typeErr.Errors {
+				msgs = append(msgs, yamlLinePrefix.ReplaceAllString(msg, ""))
+			}
+		} else {
+			msgs = append(msgs, err.Error())
+		}
+	}
+	return msgs
+}
+
+// unknownConfigFields 按照 t 的 yaml tag 检查 value 中的未知字段, path 为出错字段的路径
+func unknownConfigFields(path string, value interface{}, t reflect.Type) []string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	msgs := []string{}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		switch t.Kind() {
+		case reflect.Struct:
+			fields, rest := yamlFields(t)
+			for _, key := range keys {
+				fieldType, ok := fields[key]
+				if !ok && rest != nil {
+					fieldType, ok = rest, true
+				}
+				if !ok {
+					msgs = append(msgs, fmt.Sprintf("unknown field %s", joinConfigPath(path, key)))
+				} else {
+					msgs = append(msgs, unknownConfigFields(joinConfigPath(path, key), v[key], fieldType)...)
+				}
+			}
+		case reflect.Map:
+			for _, key := range keys {
+				msgs = append(msgs, unknownConfigFields(joinConfigPath(path, key), v[key], t.Elem())...)
+			}
+		}
+	case []interface{}:
+		if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			for i, item := range v {
+				msgs = append(msgs, unknownConfigFields(fmt.Sprintf("%s[%d]", path, i), item, t.Elem())...)
+			}
+		}
+	}
+	return msgs
+}
+
+// yamlFields 返回结构体中可由 yaml 解析的字段名及其类型, 带 inline 的内嵌结构体的字段视为外层的字段
+// 带 inline 的 map 接收其余所有的 key, 此时 rest 为该 map 的值类型, 否则为 nil
+func yamlFields(t reflect.Type) (fields map[string]reflect.Type, rest reflect.Type) {
+	fields = map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() && !field.Anonymous {
+			continue
+		}
+		tags := strings.Split(field.Tag.Get("yaml"), ",")
+		if isInlineTag(tags) {
+			fieldType := field.Type
+			for fieldType.Kind() == reflect.Ptr {
+				fieldType = fieldType.Elem()
+			}
+			switch fieldType.Kind() {
+			case reflect.Struct:
+				inlineFields, inlineRest := yamlFields(fieldType)
+				for name, inlineType := range inlineFields {
+					fields[name] = inlineType
+				}
+				if inlineRest != nil {
+					rest = inlineRest
+				}
+			case reflect.Map:
+				rest = fieldType.Elem()
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		name := tags[0]
+		if name == "-" {
+			continue
+		} else if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		fields[name] = field.Type
+	}
+	return fields, rest
+}
+
+func isInlineTag(tags []string) bool {
+	for _, tag := range tags[1:] {
+		if tag == "inline" {
+			return true
+		}
+	}
+	return false
+}
+
+func joinConfigPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
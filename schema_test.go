@@ -0,0 +1,106 @@
+package gpipe
+
+import (
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+type schemaTestConfig struct {
+	Topic   string            `yaml:"topic"`
+	Retries int               `yaml:"retries"`
+	Headers map[string]string `yaml:"headers"`
+	Jobs    []struct {
+		Tag string `yaml:"tag"`
+	} `yaml:"jobs"`
+}
+
+func TestConfig_ValidModuleConfigSchema(t *testing.T) {
+	modName := uuid.NewString()
+	assert.NoError(t, RegisterModule(NewSimpleModule(modName, func(name string, config interface{}) (ModuleInstance, error) {
+		return nil, nil
+	}, SimpleModuleWithConfigSchema(&schemaTestConfig{}))))
+
+	_, err := NewEngine().LoadConfig(strings.NewReader(`
+engine:
+  Good:
+    module: ` + modName + `
+    parent: [ ]
+    config:
+      topic: out
+      retries: 3
+      headers: { any: thing }
+      jobs: [ { tag: a } ]
+`))
+	assert.NoError(t, err)
+
+	_, err = NewEngine().LoadConfig(strings.NewReader(`
+engine:
+  A:
+    module: ` + modName + `
+    parent: [ ]
+    config:
+      topik: out
+      retries: many
+  B:
+    module: ` + modName + `
+    parent: [ A ]
+    config:
+      jobs: [ { tag: a, tga: b } ]
+  Unknown:
+    module: not-registered
+    parent: [ A ]
+    config:
+      whatever: 1
+`))
+	if assert.Error(t, err) {
+		msgs := strings.Split(err.Error(), "\n")
+		assert.Len(t, msgs, 3)
+		assert.Contains(t, msgs[0], "line 3: worker A config: unknown field topik")
+		assert.Contains(t, msgs[1], "line 3: worker A config: cannot unmarshal !!str `many` into int")
+		assert.Contains(t, msgs[2], "line 9: worker B config: unknown field jobs[0].tga")
+	}
+}
+
+type schemaTestBase struct {
+	Topic string `yaml:"topic"`
+}
+
+type schemaTestInlineConfig struct {
+	schemaTestBase `yaml:",inline"`
+	Retries        int `yaml:"retries"`
+	Extra          struct {
+		Name  string                 `yaml:"name"`
+		Other map[string]interface{} `yaml:",inline"`
+	} `yaml:"extra"`
+}
+
+func TestConfig_ValidModuleConfigSchemaInline(t *testing.T) {
+	modName := uuid.NewString()
+	assert.NoError(t, RegisterModule(NewSimpleModule(modName, func(name string, config interface{}) (ModuleInstance, error) {
+		return nil, nil
+	}, SimpleModuleWithConfigSchema(&schemaTestInlineConfig{}))))
+
+	_, err := NewEngine().LoadConfig(strings.NewReader(`
+engine:
+  Good:
+    module: ` + modName + `
+    parent: [ ]
+    config:
+      topic: out
+      retries: 3
+      extra: { name: a, anything: b }
+`))
+	assert.NoError(t, err)
+
+	_, err = NewEngine().LoadConfig(strings.NewReader(`
+engine:
+  Bad:
+    module: ` + modName + `
+    parent: [ ]
+    config:
+      topik: out
+`))
+	assert.ErrorContains(t, err, "unknown field topik")
+}
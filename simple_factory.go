@@ -6,8 +6,20 @@ import (
 
 // simpleModule 一个简易的通用模块，使用 NewSimpleModule 输入 func 即可构造，省点事
 type simpleModule struct {
-	name    string
-	newFunc func(name string, config interface{}) (ModuleInstance, error)
+	name     string
+	newFunc  func(name string, config interface{}) (ModuleInstance, error)
+	defaults *NodeDefaults
+	schema   interface{}
+	info     ModuleMetadata
+}
+
+type SimpleModuleOption func(*simpleModule)
+
+// SimpleModuleWithDefaults 设置该模块节点未配置 queueSize / parallels 时使用的默认值
+func SimpleModuleWithDefaults(defaults NodeDefaults) SimpleModuleOption {
+	return func(s *simpleModule) {
+		s.defaults = &defaults
+	}
 }
 
 func (s *simpleModule) Name() string {
@@ -18,11 +30,46 @@ func (s *simpleModule) New(name string, config interface{}) (ModuleInstance, err
 	return s.newFunc(name, config)
 }
 
-func NewSimpleModule(name string, newFunc func(name string, config interface{}) (ModuleInstance, error)) ModuleFactory {
-	return &simpleModule{
+// SimpleModuleWithConfigSchema 设置模块配置的结构体原型, 用于启动前校验各节点的 config
+func SimpleModuleWithConfigSchema(schema interface{}) SimpleModuleOption {
+	return func(s *simpleModule) {
+		s.schema = schema
+	}
+}
+
+// SimpleModuleWithInfo 设置模块的描述信息, 未设置 Config 时根据 SimpleModuleWithConfigSchema 的原型生成
+func SimpleModuleWithInfo(info ModuleMetadata) SimpleModuleOption {
+	return func(s *simpleModule) {
+		s.info = info
+	}
+}
+
+func (s *simpleModule) Info() ModuleMetadata {
+	info := s.info
+	info.Name = s.name
+	if info.Config == nil && s.schema != nil {
+		info.Config = ConfigFieldsOf(s.schema)
+	}
+	return info
+}
+
+func (s *simpleModule) ConfigSchema() interface{} {
+	return s.schema
+}
+
+func (s *simpleModule) Defaults() *NodeDefaults {
+	return s.defaults
+}
+
+func NewSimpleModule(name string, newFunc func(name string, config interface{}) (ModuleInstance, error), opts ...SimpleModuleOption) ModuleFactory {
+	m := &simpleModule{
 		name:    name,
 		newFunc: newFunc,
 	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
 }
 
 // simpleModuleInstance 用于构造一个状态无关的 instance，便于一些简单的 instance 开发
@@ -36,6 +83,11 @@ func (s simpleModuleInstance) Core(ctx context.Context, modCtx ModuleContext) er
 	return s.core(ctx, modCtx)
 }
 
+// moduleName 通过 Pipeline 直接传入实例时作为节点的模块名
+func (s simpleModuleInstance) moduleName() string {
+	return s.modName
+}
+
 func NewSimpleModuleInstance(modName, name string, callFunc func(ctx context.Context, modCtx ModuleContext) error) ModuleInstance {
 	return &simpleModuleInstance{
 		modName: modName,
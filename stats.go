@@ -0,0 +1,89 @@
+package gpipe
+
+// NodeStats 节点运行时统计的快照
+type NodeStats struct {
+	Name         string       `json:"name"`
+	Node         string       `json:"node"`
+	Module       string       `json:"module"`
+	Parallels    int          `json:"parallels"`
+	Paused       bool         `json:"paused"`
+	Receive      uint64       `json:"receive"`
+	Sent         uint64       `json:"sent"`
+	QueueCap     int          `json:"queueCap"`
+	QueueSize    int          `json:"queueSize"`
+	RecvQPS      []uint64     `json:"recvQPS"`
+	SendQPS      []uint64     `json:"sendQPS"`
+	QueueLatency LatencyStats `json:"queueLatency"` // 入队 -> 出队
+	NodeLatency  LatencyStats `json:"nodeLatency"`  // 出队 -> Collect/ack
+	Errors       uint64       `json:"errors"`       // Core 返回错误的次数
+	LastError    string       `json:"lastError"`    // 最近一次的错误信息
+	Downstream   []string     `json:"downstream"`
+}
+
+func (m *moduleContext) Stats() NodeStats {
+	recvQPS, sendQPS := m.GetQPS()
+	lastError, _ := m.lastError.Load().(string)
+	downstream := make([]string, 0, len(m.downstream))
+	for _, down := range m.downstream {
+		downstream = append(downstream, down.name)
+	}
+	return NodeStats{
+		Name:         m.name,
+		Node:         m.nodeName,
+		Module:       m.module.Name(),
+		Parallels:    m.parallels(),
+		Paused:       m.isPaused(),
+		Receive:      m.recvCount.Load(),
+		Sent:         m.sendCount.Load(),
+		QueueCap:     m.queueCap(),
+		QueueSize:    m.queueLen(),
+		RecvQPS:      recvQPS,
+		SendQPS:      sendQPS,
+		QueueLatency: m.queueLatency.Percentiles(),
+		NodeLatency:  m.nodeLatency.Percentiles(),
+		Errors:       m.errCount.Load(),
+		LastError:    lastError,
+		Downstream:   downstream,
+	}
+}
+
+func (m *moduleContext) recordError(err error) {
+	m.lastError.Store(err.Error())
+	m.errCount.Add(1)
+}
+
+// Stats 返回所有节点的统计信息, 按从根节点开始广度优先的顺序排列
+func (e *Engine) Stats() []NodeStats {
+	ret := []NodeStats{}
+	e.walkNodes(func(node *moduleContext) {
+		ret = append(ret, node.Stats())
+	})
+	return ret
+}
+
+// walkNodes 从所有根节点开始广度优先遍历, 每个节点只访问一次
+func (e *Engine) walkNodes(visit func(node *moduleContext)) {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	for _, node := range bfsNodes(e.dgaRoots) {
+		visit(node)
+	}
+}
+
+// bfsNodes 返回从 roots 开始广度优先遍历的所有节点, 调用方需自行持有锁
+func bfsNodes(roots []*moduleContext) []*moduleContext {
+	ret := []*moduleContext{}
+	visited := map[string]bool{}
+	nodes := append([]*moduleContext{}, roots...)
+	for len(nodes) > 0 {
+		node := nodes[0]
+		nodes = nodes[1:]
+		if visited[node.name] {
+			continue
+		}
+		visited[node.name] = true
+		ret = append(ret, node)
+		nodes = append(nodes, node.downstream...)
+	}
+	return ret
+}
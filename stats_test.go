@@ -0,0 +1,123 @@
+package gpipe
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEngine_Stats(t *testing.T) {
+	genName, slowName := uuid.NewString(), uuid.NewString()
+	const total = 20
+	done, filled := make(chan bool), make(chan bool)
+	assert.NoError(t, RegisterModule(NewSimpleModule(genName, func(name string, config interface{}) (ModuleInstance, error) {
+		return NewSimpleModuleInstance(genName, name, func(ctx context.Context, modCtx ModuleContext) error {
+			for i := 0; i < total; i++ {
+				modCtx.Collect(i)
+			}
+			close(filled)
+			return nil
+		}), nil
+	})))
+	assert.NoError(t, RegisterModule(NewSimpleModule(slowName, func(name string, config interface{}) (ModuleInstance, error) {
+		return NewSimpleModuleInstance(slowName, name, func(ctx context.Context, modCtx ModuleContext) error {
+			<-filled
+			for i := 0; i < total; i++ {
+				v := <-modCtx.MessageQueue()
+				time.Sleep(5 * time.Millisecond)
+				modCtx.Collect(v)
+			}
+			done <- true
+			return nil
+		}), nil
+	})))
+	eng := NewEngine()
+	assert.NoError(t, eng.Run(context.Background(), strings.NewReader(`
+engine:
+  Gen:
+    module: `+genName+`
+    parent: [ ]
+    queueSize: 4
+    parallels: 1
+    config: {}
+  Slow:
+    module: `+slowName+`
+    parent: [ Gen ]
+    queueSize: 20
+    parallels: 1
+    config: {}
+`)))
+	<-done
+	defer eng.Stop()
+
+	stats := eng.Stats()
+	assert.Equal(t, 2, len(stats))
+	slow := stats[1]
+	assert.Equal(t, slowName+"[Slow]", slow.Name)
+	assert.Equal(t, uint64(total), slow.Receive)
+	assert.Equal(t, uint64(total), slow.QueueLatency.Count)
+	assert.Equal(t, uint64(total), slow.NodeLatency.Count)
+	assert.GreaterOrEqual(t, slow.NodeLatency.P50, 5*time.Millisecond)
+	// 上游一次性写满队列, 排在后面的消息需要等待前面的处理完成
+	assert.Greater(t, slow.QueueLatency.P99, slow.QueueLatency.P50)
+	assert.Eventually(t, func() bool { return eng.Stats()[1].Parallels == 0 }, time.Second, time.Millisecond)
+	assert.Equal(t, []string{slow.Name}, stats[0].Downstream)
+}
+
+func TestEngine_StatsWithError(t *testing.T) {
+	modName := uuid.NewString()
+	assert.NoError(t, RegisterModule(NewSimpleModule(modName, func(name string, config interface{}) (ModuleInstance, error) {
+		return NewSimpleModuleInstance(modName, name, func(ctx context.Context, modCtx ModuleContext) error {
+			return newGPWError("broken")
+		}), nil
+	})))
+	eng := NewEngine()
+	assert.NoError(t, eng.Run(context.Background(), strings.NewReader(`
+engine:
+  Broken:
+    module: `+modName+`
+    parent: [ ]
+    queueSize: 1
+    parallels: 2
+`)))
+	defer eng.Stop()
+	time.Sleep(time.Millisecond * 100)
+	stats := eng.Stats()
+	assert.Equal(t, uint64(2), stats[0].Errors)
+	assert.Equal(t, "broken", stats[0].LastError)
+	// 已退出的 parallel 不再计入, RestartNode / ScaleNode 会重新启动它们
+	assert.Equal(t, 0, stats[0].Parallels)
+	assert.NoError(t, eng.RestartNode(context.Background(), "Broken"))
+	assert.Eventually(t, func() bool { return eng.Stats()[0].Errors == 4 }, time.Second, time.Millisecond)
+	assert.NoError(t, eng.ScaleNode("Broken", 1))
+	assert.Eventually(t, func() bool { return eng.Stats()[0].Errors == 5 }, time.Second, time.Millisecond)
+}
+
+func TestModuleContext_GetQPS(t *testing.T) {
+	m := &moduleContext{recvQPS: make([]uint64, 3), sendQPS: make([]uint64, 3)}
+	record := func(recv, sent uint64) {
+		m.recvQPS[m.qpsSeek], m.sendQPS[m.qpsSeek] = recv, sent
+		m.qpsSeek++
+		if m.qpsSeek >= len(m.recvQPS) {
+			m.qpsOverflow = true
+			m.qpsSeek = 0
+		}
+	}
+	recv, sent := m.GetQPS()
+	assert.Equal(t, []uint64{}, recv)
+	assert.Equal(t, []uint64{}, sent)
+	record(1, 10)
+	record(2, 20)
+	recv, sent = m.GetQPS()
+	assert.Equal(t, []uint64{1, 2}, recv)
+	assert.Equal(t, []uint64{10, 20}, sent)
+	record(3, 30)
+	record(4, 40)
+	// 环写满后从最旧的一项开始
+	recv, sent = m.GetQPS()
+	assert.Equal(t, []uint64{2, 3, 4}, recv)
+	assert.Equal(t, []uint64{20, 30, 40}, sent)
+}
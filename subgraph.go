@@ -0,0 +1,136 @@
+package gpipe
+
+import (
+	"sort"
+	"strings"
+)
+
+// SubgraphModulePrefix 节点的 module 以此为前缀时表示引用一个子图, 例如 subgraph/enrich
+const SubgraphModulePrefix = "subgraph/"
+
+// SubgraphConfig 可复用的子图, Input 节点接收引用节点上游的消息, Output 节点的输出发送给引用节点的下游
+type SubgraphConfig struct {
+	Input  string                     `yaml:"input"`
+	Output string                     `yaml:"output"`
+	Engine map[string]*WorkNodeConfig `yaml:"engine"`
+}
+
+// RegisterSubgraph 在全局注册表中注册子图, 配置中的 subgraphs 同名时优先使用配置中的定义
+func RegisterSubgraph(name string, sub *SubgraphConfig) error {
+	return moduleRegister.RegisterSubgraph(name, sub)
+}
+
+// RegisterSubgraph 在代码中注册子图, 使用该注册表的 Engine 可以通过 subgraph/<name> 引用
+func (r *Registry) RegisterSubgraph(name string, sub *SubgraphConfig) error {
+	if sub == nil {
+		return newGPWError("subgraph %s is empty", name)
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, exists := r.subgraphs[name]; exists {
+		return newGPWError("subgraph %s already exists", name)
+	}
+	r.subgraphs[name] = sub
+	return nil
+}
+
+func (r *Registry) getSubgraph(name string) (*SubgraphConfig, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	sub, exists := r.subgraphs[name]
+	return sub, exists
+}
+
+func (cfg *Config) getSubgraph(name string) (*SubgraphConfig, error) {
+	if sub, exists := cfg.Subgraphs[name]; exists {
+		return sub, nil
+	} else if sub, exists := cfg.getRegistry().getSubgraph(name); exists {
+		return sub, nil
+	}
+	return nil, newGPWError("subgraph %s not exists", name)
+}
+
+func (sub *SubgraphConfig) valid(name string) error {
+	if sub == nil {
+		return newGPWError("subgraph %s is empty", name)
+	}
+	for childName, childCfg := range sub.Engine {
+		if childCfg == nil {
+			return newGPWError("subgraph %s worker %s is empty", name, childName)
+		}
+	}
+	if _, exists := sub.Engine[sub.Input]; !exists {
+		return newGPWError("subgraph %s has invalid input %s", name, sub.Input)
+	} else if _, exists := sub.Engine[sub.Output]; !exists {
+		return newGPWError("subgraph %s has invalid output %s", name, sub.Output)
+	} else if len(sub.Engine[sub.Input].Parent) > 0 {
+		return newGPWError("subgraph %s input %s must not have parent", name, sub.Input)
+	}
+	return nil
+}
+
+// expandSubgraphs 将引用子图的节点展开为 `节点名.子节点名` 的一组节点, 直到不再有子图节点
+func (cfg *Config) expandSubgraphs() error {
+	for {
+		names := make([]string, 0, len(cfg.Engine))
+		for name, nodeCfg := range cfg.Engine {
+			if strings.HasPrefix(nodeCfg.Module, SubgraphModulePrefix) {
+				names = append(names, name)
+			}
+		}
+		if len(names) == 0 {
+			return nil
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if err := cfg.expandSubgraph(name); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (cfg *Config) expandSubgraph(name string) error {
+	instance := cfg.Engine[name]
+	subName := strings.TrimPrefix(instance.Module, SubgraphModulePrefix)
+	for _, expanding := range instance.subgraphs {
+		if expanding == subName {
+			return newGPWError("subgraph %s references itself", subName)
+		}
+	}
+	sub, err := cfg.getSubgraph(subName)
+	if err != nil {
+		return newGPWError("worker %s: %s", name, err)
+	} else if err := sub.valid(subName); err != nil {
+		return err
+	}
+
+	delete(cfg.Engine, name)
+	for childName, childCfg := range sub.Engine {
+		fullName := name + "." + childName
+		if _, exists := cfg.Engine[fullName]; exists {
+			return newGPWError("duplicate worker name: %s", fullName)
+		}
+		child := *childCfg
+		child.Parent = make([]string, 0, len(childCfg.Parent))
+		for _, parent := range childCfg.Parent {
+			child.Parent = append(child.Parent, name+"."+parent)
+		}
+		if childName == sub.Input {
+			child.Parent = append(child.Parent, instance.Parent...)
+		}
+		child.subgraph = name
+		child.subgraphs = append(append([]string{}, instance.subgraphs...), subName)
+		cfg.Engine[fullName] = &child
+	}
+	// 原先以引用节点为上级的节点改为接在子图的 output 之后
+	output := name + "." + sub.Output
+	for _, nodeCfg := range cfg.Engine {
+		for i, parent := range nodeCfg.Parent {
+			if parent == name {
+				nodeCfg.Parent[i] = output
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package gpipe
+
+import (
+	"context"
+	"github.com/goccy/go-graphviz"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestEngine_Subgraph(t *testing.T) {
+	genName, addName, sinkName := uuid.NewString(), uuid.NewString(), uuid.NewString()
+	enrich, wrap := uuid.NewString(), uuid.NewString()
+	const total = 10
+	recv := make(chan int, total)
+	assert.NoError(t, RegisterModule(NewSimpleModule(genName, func(name string, config interface{}) (ModuleInstance, error) {
+		return NewSimpleModuleInstance(genName, name, func(ctx context.Context, modCtx ModuleContext) error {
+			for i := 0; i < total; i++ {
+				modCtx.Collect(i)
+			}
+			return nil
+		}), nil
+	})))
+	assert.NoError(t, RegisterModule(NewSimpleModule(addName, func(name string, config interface{}) (ModuleInstance, error) {
+		delta := config.(map[string]interface{})["delta"].(int)
+		return NewSimpleModuleInstance(addName, name, func(ctx context.Context, modCtx ModuleContext) error {
+			for {
+				select {
+				case <-ctx.Done():
+					return nil
+				case v := <-modCtx.MessageQueue():
+					modCtx.Collect(v.(int) + delta)
+				}
+			}
+		}), nil
+	})))
+	assert.NoError(t, RegisterModule(NewSimpleModule(sinkName, func(name string, config interface{}) (ModuleInstance, error) {
+		return NewSimpleModuleInstance(sinkName, name, func(ctx context.Context, modCtx ModuleContext) error {
+			for {
+				select {
+				case <-ctx.Done():
+					return nil
+				case v := <-modCtx.MessageQueue():
+					recv <- v.(int)
+				}
+			}
+		}), nil
+	})))
+	// wrap 定义在代码中, 内部又引用了配置中定义的 enrich
+	assert.NoError(t, RegisterSubgraph(wrap, &SubgraphConfig{
+		Input:  "Inner",
+		Output: "Hundred",
+		Engine: map[string]*WorkNodeConfig{
+			"Inner":   {Module: SubgraphModulePrefix + enrich, Parent: []string{}, QueueSize: 1, Parallels: 1},
+			"Hundred": {Module: addName, Parent: []string{"Inner"}, QueueSize: 1, Parallels: 1, Config: map[string]interface{}{"delta": 100}},
+		},
+	}))
+
+	eng := NewEngine()
+	assert.NoError(t, eng.Run(context.Background(), strings.NewReader(`
+subgraphs:
+  `+enrich+`:
+    input: One
+    output: Ten
+    engine:
+      One:
+        module: `+addName+`
+        parent: [ ]
+        queueSize: 1
+        parallels: 1
+        config: { delta: 1 }
+      Ten:
+        module: `+addName+`
+        parent: [ One ]
+        queueSize: 1
+        parallels: 1
+        config: { delta: 10 }
+engine:
+  Gen:
+    module: `+genName+`
+    parent: [ ]
+    queueSize: 1
+    parallels: 1
+  Enrich:
+    module: subgraph/`+wrap+`
+    parent: [ Gen ]
+  Sink:
+    module: `+sinkName+`
+    parent: [ Enrich ]
+    queueSize: 1
+    parallels: 1
+`)))
+	defer eng.Stop()
+	sum := 0
+	for i := 0; i < total; i++ {
+		sum += <-recv
+	}
+	assert.Equal(t, total*(total-1)/2+111*total, sum)
+
+	names := []string{}
+	for _, node := range eng.Topology().Nodes {
+		names = append(names, node.Name+"@"+node.Subgraph)
+	}
+	assert.Equal(t, []string{"Enrich.Hundred@Enrich", "Enrich.Inner.One@Enrich.Inner", "Enrich.Inner.Ten@Enrich.Inner", "Gen@", "Sink@"}, names)
+
+	dot, err := eng.GraphState(graphviz.XDOT)
+	assert.NoError(t, err)
+	assert.Contains(t, dot, "cluster_Enrich")
+	assert.Contains(t, dot, "cluster_Enrich.Inner")
+}
+
+func TestEngine_SubgraphError(t *testing.T) {
+	self := uuid.NewString()
+	for cfg, msg := range map[string]string{
+		`
+engine:
+  A:
+    module: subgraph/missing
+    parent: [ ]`: "subgraph missing not exists",
+		`
+subgraphs:
+  ` + self + `:
+    input: A
+    output: A
+    engine:
+      A: { module: subgraph/` + self + `, parent: [ ] }
+engine:
+  A:
+    module: subgraph/` + self + `
+    parent: [ ]`: "references itself",
+		`
+subgraphs:
+  loop:
+    input: A
+    output: B
+    engine:
+      A: { module: interval, parent: [ ] }
+      B: { module: interval, parent: [ A ] }
+engine:
+  X:
+    module: subgraph/loop
+    parent: [ Y ]
+  Y:
+    module: interval
+    parent: [ X ]`: "has cycle",
+		`
+subgraphs:
+  bad:
+    input: A
+    output: C
+    engine:
+      A: { module: interval, parent: [ ] }
+engine:
+  X:
+    module: subgraph/bad
+    parent: [ ]`: "invalid output C",
+	} {
+		_, err := NewEngine().LoadConfig(strings.NewReader(cfg))
+		if assert.Error(t, err, cfg) {
+			assert.Contains(t, err.Error(), msg)
+		}
+	}
+}
+
+func TestEngine_SubgraphEmpty(t *testing.T) {
+	_, err := NewEngine().LoadConfig(strings.NewReader(`
+subgraphs:
+  empty:
+engine:
+  A:
+    module: subgraph/empty
+    parent: [ ]
+`))
+	assert.ErrorContains(t, err, "line 3: subgraph empty is empty")
+
+	_, err = NewEngine().LoadConfig(strings.NewReader(`
+subgraphs:
+  sub:
+    input: A
+    output: A
+    engine:
+      A:
+engine:
+  A:
+    module: subgraph/sub
+    parent: [ ]
+`))
+	assert.ErrorContains(t, err, "line 7: subgraph sub worker A is empty")
+
+	registry := NewRegistry()
+	assert.Error(t, registry.RegisterSubgraph("nil", nil))
+	assert.NoError(t, registry.RegisterSubgraph("sub", &SubgraphConfig{Input: "A", Output: "A", Engine: map[string]*WorkNodeConfig{"A": nil}}))
+	assert.Error(t, registry.RegisterSubgraph("sub", &SubgraphConfig{}))
+	_, err = NewEngine(EngineWithRegistry(registry)).LoadConfig(strings.NewReader(`
+engine:
+  A:
+    module: subgraph/sub
+    parent: [ ]
+`))
+	assert.ErrorContains(t, err, "subgraph sub worker A is empty")
+	// 注册在其他注册表中的子图不可见
+	_, err = NewEngine().LoadConfig(strings.NewReader(`
+engine:
+  A:
+    module: subgraph/sub
+    parent: [ ]
+`))
+	assert.ErrorContains(t, err, "subgraph sub not exists")
+}
@@ -0,0 +1,157 @@
+package gpipe
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// TopologyNode 拓扑中的节点, Stats 仅在从运行中的 Engine 导出时存在
+type TopologyNode struct {
+	Name      string     `json:"name"`
+	Module    string     `json:"module"`
+	Parent    []string   `json:"parent"`
+	QueueSize int        `json:"queueSize"`
+	Parallels int        `json:"parallels"`
+	Subgraph  string     `json:"subgraph,omitempty"` // 由子图展开时所属的子图实例名
+	Stats     *NodeStats `json:"stats,omitempty"`
+}
+
+type TopologyEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Sent uint64 `json:"sent"` // 上游节点的发送计数, 静态导出时为 0
+}
+
+// Topology 不依赖 graphviz 的拓扑描述, 可导出为 JSON / Mermaid / PlantUML
+type Topology struct {
+	Nodes []TopologyNode `json:"nodes"`
+	Edges []TopologyEdge `json:"edges"`
+}
+
+// Topology 根据配置静态生成拓扑, 无需运行 Engine
+func (cfg *Config) Topology() *Topology {
+	topo := &Topology{Nodes: []TopologyNode{}, Edges: []TopologyEdge{}}
+	for name, nodeCfg := range cfg.Engine {
+		topo.Nodes = append(topo.Nodes, TopologyNode{
+			Name:      name,
+			Module:    nodeCfg.Module,
+			Parent:    append([]string{}, nodeCfg.Parent...),
+			QueueSize: nodeCfg.QueueSize,
+			Parallels: nodeCfg.Parallels,
+			Subgraph:  nodeCfg.subgraph,
+		})
+		for _, parent := range nodeCfg.Parent {
+			topo.Edges = append(topo.Edges, TopologyEdge{From: parent, To: name})
+		}
+	}
+	topo.sort()
+	return topo
+}
+
+// Topology 导出运行中 Engine 的拓扑及各节点的统计信息
+func (e *Engine) Topology() *Topology {
+	topo := &Topology{Nodes: []TopologyNode{}, Edges: []TopologyEdge{}}
+	e.walkNodes(func(node *moduleContext) {
+		stats := node.Stats()
+		topo.Nodes = append(topo.Nodes, TopologyNode{
+			Name:      node.nodeName,
+			Module:    node.module.Name(),
+			Parent:    append([]string{}, node.engCfg.Parent...),
+			QueueSize: node.engCfg.QueueSize,
+			Parallels: stats.Parallels,
+			Subgraph:  node.engCfg.subgraph,
+			Stats:     &stats,
+		})
+		for _, down := range node.downstream {
+			topo.Edges = append(topo.Edges, TopologyEdge{From: node.nodeName, To: down.nodeName, Sent: stats.Sent})
+		}
+	})
+	topo.sort()
+	return topo
+}
+
+func (t *Topology) sort() {
+	sort.Slice(t.Nodes, func(i, j int) bool { return t.Nodes[i].Name < t.Nodes[j].Name })
+	sort.Slice(t.Edges, func(i, j int) bool {
+		if t.Edges[i].From != t.Edges[j].From {
+			return t.Edges[i].From < t.Edges[j].From
+		}
+		return t.Edges[i].To < t.Edges[j].To
+	})
+}
+
+func (t *Topology) JSON() (string, error) {
+	data, err := json.MarshalIndent(t, "", "  ")
+	return string(data), err
+}
+
+// Mermaid 导出为 Mermaid flowchart, 可直接嵌入 Markdown 的 ```mermaid 代码块
+func (t *Topology) Mermaid() string {
+	ids := t.identifiers()
+	sb := strings.Builder{}
+	sb.WriteString("flowchart TB\n")
+	for _, node := range t.Nodes {
+		label := fmt.Sprintf("%s<br/>%s", node.Name, node.Module)
+		if node.Stats != nil {
+			label += fmt.Sprintf("<br/>queue %d/%d, recv %d", node.Stats.QueueSize, node.Stats.QueueCap, node.Stats.Receive)
+		}
+		sb.WriteString(fmt.Sprintf("    %s[\"%s\"]\n", ids[node.Name], strings.ReplaceAll(label, `"`, "#quot;")))
+	}
+	for _, edge := range t.Edges {
+		if edge.Sent > 0 {
+			sb.WriteString(fmt.Sprintf("    %s -->|sent %d| %s\n", ids[edge.From], edge.Sent, ids[edge.To]))
+		} else {
+			sb.WriteString(fmt.Sprintf("    %s --> %s\n", ids[edge.From], ids[edge.To]))
+		}
+	}
+	return sb.String()
+}
+
+// PlantUML 导出为 PlantUML 组件图
+func (t *Topology) PlantUML() string {
+	ids := t.identifiers()
+	sb := strings.Builder{}
+	sb.WriteString("@startuml\n")
+	for _, node := range t.Nodes {
+		label := fmt.Sprintf("%s\\n%s", node.Name, node.Module)
+		if node.Stats != nil {
+			label += fmt.Sprintf("\\nqueue %d/%d, recv %d", node.Stats.QueueSize, node.Stats.QueueCap, node.Stats.Receive)
+		}
+		sb.WriteString(fmt.Sprintf("rectangle \"%s\" as %s\n", strings.ReplaceAll(label, `"`, `'`), ids[node.Name]))
+	}
+	for _, edge := range t.Edges {
+		if edge.Sent > 0 {
+			sb.WriteString(fmt.Sprintf("%s --> %s : sent %d\n", ids[edge.From], ids[edge.To], edge.Sent))
+		} else {
+			sb.WriteString(fmt.Sprintf("%s --> %s\n", ids[edge.From], ids[edge.To]))
+		}
+	}
+	sb.WriteString("@enduml\n")
+	return sb.String()
+}
+
+// identifiers 节点名可能包含任意字符, 为 Mermaid / PlantUML 生成只包含字母数字下划线的唯一标识
+func (t *Topology) identifiers() map[string]string {
+	ids := map[string]string{}
+	used := map[string]bool{}
+	for _, node := range t.Nodes {
+		id := strings.Map(func(r rune) rune {
+			if r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+				return r
+			}
+			return '_'
+		}, node.Name)
+		if id == "" || id == "end" {
+			// end 是 Mermaid 的保留字
+			id += "_"
+		}
+		for base, i := id, 1; used[id]; i++ {
+			id = fmt.Sprintf("%s_%d", base, i)
+		}
+		used[id] = true
+		ids[node.Name] = id
+	}
+	return ids
+}
@@ -0,0 +1,59 @@
+package gpipe
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+const topologyTestConfig = `
+engine:
+  Gen:
+    module: timer/interval
+    parent: [ ]
+    queueSize: 1
+    parallels: 1
+  Double-It:
+    module: double
+    parent: [ Gen ]
+    queueSize: 4
+    parallels: 2
+  end:
+    module: sink/blackhole
+    parent: [ Gen, Double-It ]
+    queueSize: 1
+    parallels: 1
+`
+
+func TestConfig_Topology(t *testing.T) {
+	cfg, err := NewEngine().LoadConfig(strings.NewReader(topologyTestConfig))
+	assert.NoError(t, err)
+	topo := cfg.Topology()
+
+	assert.Equal(t, `flowchart TB
+    Double_It["Double-It<br/>double"]
+    Gen["Gen<br/>timer/interval"]
+    end_["end<br/>sink/blackhole"]
+    Double_It --> end_
+    Gen --> Double_It
+    Gen --> end_
+`, topo.Mermaid())
+
+	assert.Equal(t, `@startuml
+rectangle "Double-It\ndouble" as Double_It
+rectangle "Gen\ntimer/interval" as Gen
+rectangle "end\nsink/blackhole" as end_
+Double_It --> end_
+Gen --> Double_It
+Gen --> end_
+@enduml
+`, topo.PlantUML())
+
+	data, err := topo.JSON()
+	assert.NoError(t, err)
+	decoded := &Topology{}
+	assert.NoError(t, json.Unmarshal([]byte(data), decoded))
+	assert.Equal(t, topo, decoded)
+	assert.Equal(t, 2, decoded.Nodes[0].Parallels)
+}
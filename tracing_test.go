@@ -0,0 +1,86 @@
+package gpipe
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEngine_Tracing(t *testing.T) {
+	genName, fwdName, sinkName := uuid.NewString(), uuid.NewString(), uuid.NewString()
+	const total = 3
+	done := make(chan bool)
+	assert.NoError(t, RegisterModule(NewSimpleModule(genName, func(name string, config interface{}) (ModuleInstance, error) {
+		return NewSimpleModuleInstance(genName, name, func(ctx context.Context, modCtx ModuleContext) error {
+			for i := 0; i < total; i++ {
+				modCtx.Collect(i)
+			}
+			return nil
+		}), nil
+	})))
+	assert.NoError(t, RegisterModule(NewSimpleModule(fwdName, func(name string, config interface{}) (ModuleInstance, error) {
+		return NewSimpleModuleInstance(fwdName, name, func(ctx context.Context, modCtx ModuleContext) error {
+			for v := range modCtx.MessageQueue() {
+				modCtx.Collect(v)
+			}
+			return nil
+		}), nil
+	})))
+	assert.NoError(t, RegisterModule(NewSimpleModule(sinkName, func(name string, config interface{}) (ModuleInstance, error) {
+		return NewSimpleModuleInstance(sinkName, name, func(ctx context.Context, modCtx ModuleContext) error {
+			for i := 0; i < total; i++ {
+				<-modCtx.MessageQueue()
+			}
+			done <- true
+			<-ctx.Done()
+			return nil
+		}), nil
+	})))
+
+	exporter := tracetest.NewInMemoryExporter()
+	eng := NewEngine(EngineWithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))))
+	assert.NoError(t, eng.Run(context.Background(), strings.NewReader(fmt.Sprintf(`
+engine:
+  Gen:
+    module: %s
+    parent: [ ]
+    queueSize: 1
+    parallels: 1
+  Forward:
+    module: %s
+    parent: [ Gen ]
+    queueSize: 1
+    parallels: 1
+  Sink:
+    module: %s
+    parent: [ Forward ]
+    queueSize: 1
+    parallels: 1
+`, genName, fwdName, sinkName))))
+	<-done
+	eng.Stop()
+	time.Sleep(time.Millisecond * 100)
+
+	// 每条消息一条 trace: Gen -> Forward -> Sink
+	traces := map[string]map[string]tracetest.SpanStub{}
+	for _, span := range exporter.GetSpans() {
+		traceID := span.SpanContext.TraceID().String()
+		if traces[traceID] == nil {
+			traces[traceID] = map[string]tracetest.SpanStub{}
+		}
+		traces[traceID][span.Name] = span
+	}
+	assert.Equal(t, total, len(traces))
+	for _, spans := range traces {
+		gen, fwd, sink := spans[genName+"[Gen]"], spans[fwdName+"[Forward]"], spans[sinkName+"[Sink]"]
+		assert.False(t, gen.Parent.IsValid())
+		assert.Equal(t, gen.SpanContext.SpanID(), fwd.Parent.SpanID())
+		assert.Equal(t, fwd.SpanContext.SpanID(), sink.Parent.SpanID())
+	}
+}
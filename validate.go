@@ -0,0 +1,154 @@
+package gpipe
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+type DiagnosticSeverity string
+
+const (
+	DiagnosticError   DiagnosticSeverity = "error"
+	DiagnosticWarning DiagnosticSeverity = "warning"
+)
+
+// Diagnostic Validate 报告的一条问题, Pos 为节点在配置文件中的位置
+type Diagnostic struct {
+	Severity DiagnosticSeverity `json:"severity"`
+	Node     string             `json:"node,omitempty"`
+	Pos      string             `json:"pos,omitempty"`
+	Message  string             `json:"message"`
+}
+
+func (d Diagnostic) String() string {
+	parts := []string{}
+	if d.Pos != "" {
+		parts = append(parts, d.Pos)
+	}
+	parts = append(parts, string(d.Severity))
+	if d.Node != "" {
+		parts = append(parts, "worker "+d.Node)
+	}
+	return strings.Join(append(parts, d.Message), ": ")
+}
+
+// HasErrors 是否存在 error 级别的问题
+func HasErrors(diags []Diagnostic) bool {
+	for _, diag := range diags {
+		if diag.Severity == DiagnosticError {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate 加载并检查配置, 构造 (但不启动) 所有节点的 ModuleInstance, 用于在 CI 中检查配置
+// 构造的实例随即释放: 与运行时一致, 未实现 Initializer 的实例会调用 Close, 实现了 Initializer 的实例未调用 Init, 因此不会调用 Close
+// 配置无法解析时返回 error, 其余问题均以 Diagnostic 的形式返回
+func (e *Engine) Validate(cfg io.Reader) ([]Diagnostic, error) {
+	if err := e.loadPlugins(); err != nil {
+		return nil, err
+	}
+	configMap, err := e.newConfigLoader(cfg).decode(cfg)
+	if err != nil {
+		return nil, err
+	}
+	diags := []Diagnostic{}
+	report := func(severity DiagnosticSeverity, name string, format string, args ...interface{}) {
+		diag := Diagnostic{
+			Severity: severity,
+			Node:     name,
+			Message:  redact(fmt.Sprintf(format, args...), configMap.secrets),
+		}
+		if nodeCfg, ok := configMap.Engine[name]; ok {
+			diag.Pos = nodeCfg.pos
+		}
+		diags = append(diags, diag)
+	}
+	if err := configMap.workerNameIsValid(); err != nil {
+		report(DiagnosticError, "", "%s", err)
+	} else if err := configMap.hasInvalidParent(); err == nil {
+		if err := configMap.hasCycle(); err != nil {
+			report(DiagnosticError, "", "%s", err)
+		}
+	}
+
+	downstream := map[string][]string{}
+	for _, name := range configMap.sortedNames() {
+		for _, parent := range configMap.Engine[name].Parent {
+			downstream[parent] = append(downstream[parent], name)
+		}
+	}
+	reachable := configMap.reachableNodes(downstream)
+
+	for _, name := range configMap.sortedNames() {
+		nodeCfg := configMap.Engine[name]
+		if msg := nodeCfg.sizeError(); msg != "" {
+			report(DiagnosticError, name, "%s", msg)
+		}
+		for _, parent := range configMap.invalidParents(name) {
+			report(DiagnosticError, name, "invalid parent %s", parent)
+		}
+		if !reachable[name] {
+			// 环本身已作为错误报告, 这里只提示该节点不会收到任何消息
+			report(DiagnosticWarning, name, "not reachable from any root node, it never receives messages")
+		}
+		if mod, err := nodeCfg.moduleFactory(configMap.getRegistry()); err != nil {
+			report(DiagnosticError, name, "%s", err)
+		} else {
+			if withSchema, ok := mod.(ModuleConfigSchema); ok && withSchema.ConfigSchema() != nil {
+				for _, msg := range validateConfigSchema(nodeCfg.Config, withSchema.ConfigSchema()) {
+					report(DiagnosticError, name, "config: %s", msg)
+				}
+			}
+			if inst, err := mod.New(name, nodeCfg.Config); err != nil {
+				report(DiagnosticError, name, "failed to construct module %s: %s", nodeCfg.Module, err)
+			} else if err := releaseInstance(inst); err != nil {
+				report(DiagnosticWarning, name, "failed to close module %s: %s", nodeCfg.Module, err)
+			}
+		}
+
+		switch {
+		case len(nodeCfg.Parent) == 0 && len(downstream[name]) == 0:
+			report(DiagnosticWarning, name, "sink without parents, it neither receives nor sends messages to other nodes")
+		case len(nodeCfg.Parent) == 0 && nodeCfg.queueSizeSet && nodeCfg.QueueSize > 0:
+			report(DiagnosticWarning, name, "source with queueSize %d, root nodes never receive messages", nodeCfg.QueueSize)
+		case len(nodeCfg.Parent) > 1 && nodeCfg.QueueSize < len(nodeCfg.Parent):
+			report(DiagnosticWarning, name, "fan-in of %d parents with queueSize %d, parents may block each other", len(nodeCfg.Parent), nodeCfg.QueueSize)
+		}
+	}
+	return diags, nil
+}
+
+// releaseInstance 释放只构造而未运行的实例, 实现了 Initializer 的实例在 Init 中才申请资源, 不需要 Close
+func releaseInstance(inst ModuleInstance) error {
+	if _, ok := inst.(Initializer); ok {
+		return nil
+	}
+	if closer, ok := inst.(Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// reachableNodes 从所有根节点出发能到达的节点, 环上的节点没有根节点时不可达
+func (cfg *Config) reachableNodes(downstream map[string][]string) map[string]bool {
+	reachable := map[string]bool{}
+	queue := []string{}
+	for _, name := range cfg.sortedNames() {
+		if len(cfg.Engine[name].Parent) == 0 {
+			queue = append(queue, name)
+		}
+	}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if reachable[name] {
+			continue
+		}
+		reachable[name] = true
+		queue = append(queue, downstream[name]...)
+	}
+	return reachable
+}
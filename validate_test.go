@@ -0,0 +1,130 @@
+package gpipe
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestEngine_Validate(t *testing.T) {
+	modName, brokenName := uuid.NewString(), uuid.NewString()
+	constructed := 0
+	assert.NoError(t, RegisterModule(NewSimpleModule(modName, func(name string, config interface{}) (ModuleInstance, error) {
+		constructed++
+		return NewSimpleModuleInstance(modName, name, nil), nil
+	})))
+	assert.NoError(t, RegisterModule(NewSimpleModule(brokenName, func(name string, config interface{}) (ModuleInstance, error) {
+		return nil, newGPWError("bad endpoint")
+	})))
+
+	diags, err := NewEngine().Validate(strings.NewReader(`
+engine:
+  Source:
+    module: ` + modName + `
+    parent: [ ]
+    queueSize: 8
+  Left:
+    module: ` + modName + `
+    parent: [ Source ]
+  Right:
+    module: ` + modName + `
+    parent: [ Source ]
+  Join:
+    module: ` + modName + `
+    parent: [ Left, Right ]
+    queueSize: 1
+  Alone:
+    module: ` + modName + `
+    parent: [ ]
+  Broken:
+    module: ` + brokenName + `
+    parent: [ Join ]
+  Missing:
+    module: not-registered
+    parent: [ Join ]
+  LoopA:
+    module: ` + modName + `
+    parent: [ LoopB ]
+  LoopB:
+    module: ` + modName + `
+    parent: [ LoopA ]
+`))
+	assert.NoError(t, err)
+	msgs := []string{}
+	for _, diag := range diags {
+		msgs = append(msgs, diag.String())
+	}
+	assert.Equal(t, []string{
+		"error: has cycle among LoopA, LoopB",
+		"line 17: warning: worker Alone: sink without parents, it neither receives nor sends messages to other nodes",
+		"line 20: error: worker Broken: failed to construct module " + brokenName + ": bad endpoint",
+		"line 13: warning: worker Join: fan-in of 2 parents with queueSize 1, parents may block each other",
+		"line 26: warning: worker LoopA: not reachable from any root node, it never receives messages",
+		"line 29: warning: worker LoopB: not reachable from any root node, it never receives messages",
+		"line 23: error: worker Missing: module not-registered not exists",
+		"line 3: warning: worker Source: source with queueSize 8, root nodes never receive messages",
+	}, msgs)
+	assert.True(t, HasErrors(diags))
+	assert.Equal(t, 7, constructed)
+
+	_, err = NewEngine().Validate(strings.NewReader("engine: [ "))
+	assert.Error(t, err)
+}
+
+// closerInstance 只实现 Closer, 资源在 New 中申请
+type closerInstance struct {
+	closed   *int
+	closeErr error
+}
+
+func (c *closerInstance) Core(ctx context.Context, modCtx ModuleContext) error {
+	return nil
+}
+
+func (c *closerInstance) Close() error {
+	*c.closed++
+	return c.closeErr
+}
+
+func TestEngine_ValidateClosesInstances(t *testing.T) {
+	closerName, lifecycleName := uuid.NewString(), uuid.NewString()
+	closed := 0
+	lifecycles := []*lifecycleInstance{}
+	assert.NoError(t, RegisterModule(NewSimpleModule(closerName, func(name string, config interface{}) (ModuleInstance, error) {
+		if name == "Failing" {
+			return &closerInstance{closed: &closed, closeErr: newGPWError("close failed")}, nil
+		}
+		return &closerInstance{closed: &closed}, nil
+	})))
+	assert.NoError(t, RegisterModule(NewSimpleModule(lifecycleName, func(name string, config interface{}) (ModuleInstance, error) {
+		inst := &lifecycleInstance{}
+		lifecycles = append(lifecycles, inst)
+		return inst, nil
+	})))
+
+	diags, err := NewEngine().Validate(strings.NewReader(`
+engine:
+  Source:
+    module: ` + closerName + `
+    parent: [ ]
+  Failing:
+    module: ` + closerName + `
+    parent: [ Source ]
+  Init:
+    module: ` + lifecycleName + `
+    parent: [ Source ]
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, closed)
+	// 实现了 Initializer 的实例没有调用 Init, 也不会调用 Close
+	assert.Len(t, lifecycles, 1)
+	assert.Empty(t, lifecycles[0].recorded())
+	assert.Equal(t, []Diagnostic{{
+		Severity: DiagnosticWarning,
+		Node:     "Failing",
+		Pos:      "line 6",
+		Message:  "failed to close module " + closerName + ": close failed",
+	}}, diags)
+}